@@ -0,0 +1,524 @@
+// Copyright © 2022 Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Command golibsass compiles SCSS and Sass to CSS.
+//
+// It accepts the same flags and arguments as sassc, so it can be used as a
+// drop-in replacement:
+//
+//	golibsass [options] [INPUT] [OUTPUT]
+//
+// INPUT may be a file, a directory or "-" for stdin (the default).
+// If INPUT is a directory, all non-partial .scss and .sass files in it are
+// compiled into the OUTPUT directory, keeping the directory structure.
+// Without OUTPUT, the CSS is written to stdout.
+//
+// With --diagnostics=json or --diagnostics=sarif, errors and warnings are
+// written to stderr as a JSON or SARIF report, see package diagnostics.
+//
+// The exit code is 0 on success, 1 for compile errors, 2 for usage errors
+// and 3 for I/O errors.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+
+	"github.com/bep/golibsass/libsass"
+	"github.com/bep/golibsass/libsass/diagnostics"
+	"github.com/bep/golibsass/libsass/watch"
+)
+
+const (
+	exitOK           = 0
+	exitCompileError = 1
+	exitUsageError   = 2
+	exitIOError      = 3
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// ioError marks errors reading and writing files, as opposed to compile errors.
+type ioError struct {
+	err error
+}
+
+func (e ioError) Error() string { return e.err.Error() }
+func (e ioError) Unwrap() error { return e.err }
+
+// usageError marks invalid flags and arguments.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string { return e.msg }
+
+type config struct {
+	stdin          bool
+	style          string
+	lineComments   bool
+	loadPaths      stringsFlag
+	sourceMap      sourceMapFlag
+	omitMapComment bool
+	mapContents    bool
+	mapRoot        string
+	mapFileURLs    bool
+	precision      int
+	sass           bool
+	watch          bool
+	diagnostics    string
+	version        bool
+}
+
+// stringsFlag is a flag that can be repeated.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string { return strings.Join(*f, string(filepath.ListSeparator)) }
+func (f *stringsFlag) Set(s string) error {
+	// Like sassc, also accept a list separated by the OS path list separator.
+	*f = append(*f, filepath.SplitList(s)...)
+	return nil
+}
+
+// sourceMapFlag is the --sourcemap flag, which can be given without a value.
+type sourceMapFlag string
+
+func (f *sourceMapFlag) String() string   { return string(*f) }
+func (f *sourceMapFlag) IsBoolFlag() bool { return true }
+func (f *sourceMapFlag) Set(s string) error {
+	switch s {
+	case "true", "auto":
+		*f = "auto"
+	case "inline":
+		*f = "inline"
+	case "false", "none":
+		*f = ""
+	default:
+		return fmt.Errorf("invalid source map type %q, must be auto or inline", s)
+	}
+	return nil
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var cfg config
+	flags := flag.NewFlagSet("golibsass", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	boolVar := func(p *bool, names []string, usage string) {
+		for _, name := range names {
+			flags.BoolVar(p, name, false, usage)
+		}
+	}
+	stringVar := func(p *string, names []string, value, usage string) {
+		for _, name := range names {
+			flags.StringVar(p, name, value, usage)
+		}
+	}
+	boolVar(&cfg.stdin, []string{"s", "stdin"}, "Read input from standard input instead of an input file.")
+	stringVar(&cfg.style, []string{"t", "style"}, "nested", "Output style. Can be: nested, expanded, compact, compressed.")
+	boolVar(&cfg.lineComments, []string{"l", "line-numbers", "line-comments"}, "Emit comments showing original line numbers.")
+	for _, name := range []string{"I", "load-path"} {
+		flags.Var(&cfg.loadPaths, name, "Set Sass import path.")
+	}
+	for _, name := range []string{"m", "sourcemap"} {
+		flags.Var(&cfg.sourceMap, name, "Emit source map (auto or inline).")
+	}
+	boolVar(&cfg.omitMapComment, []string{"M", "omit-map-comment"}, "Omits the source map url comment.")
+	boolVar(&cfg.mapContents, []string{"sourcemap-contents"}, "Embed the sources in the source map.")
+	stringVar(&cfg.mapRoot, []string{"sourcemap-root"}, "", "Set the source map sourceRoot.")
+	boolVar(&cfg.mapFileURLs, []string{"sourcemap-file-urls"}, "Use file:// URLs for the sources in the source map.")
+	for _, name := range []string{"p", "precision"} {
+		flags.IntVar(&cfg.precision, name, 10, "Set the precision for numbers.")
+	}
+	boolVar(&cfg.sass, []string{"a", "sass"}, "Treat input as indented syntax.")
+	boolVar(&cfg.watch, []string{"w", "watch"}, "Recompile when the input or its dependencies change.")
+	stringVar(&cfg.diagnostics, []string{"diagnostics"}, "", "Write errors and warnings to stderr as a report. Can be: json, sarif.")
+	boolVar(&cfg.version, []string{"v", "version"}, "Display compiled versions.")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: golibsass [options] [INPUT] [OUTPUT]")
+		fmt.Fprintln(stderr)
+		flags.PrintDefaults()
+	}
+
+	// Allow flags after the arguments, e.g. "golibsass in.scss out.css -t compressed".
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return exitOK
+			}
+			return exitUsageError
+		}
+		rest := flags.Args()
+		if len(rest) == 0 {
+			break
+		}
+		if len(args) > len(rest) && args[len(args)-len(rest)-1] == "--" {
+			// Everything after "--" is an argument.
+			positional = append(positional, rest...)
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+
+	if cfg.version {
+		version := "(devel)"
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			for _, dep := range append([]*debug.Module{&bi.Main}, bi.Deps...) {
+				if dep.Path == "github.com/bep/golibsass" && dep.Version != "" {
+					version = dep.Version
+				}
+			}
+		}
+		fmt.Fprintf(stdout, "golibsass: %s\n", version)
+		return exitOK
+	}
+
+	if cfg.diagnostics != "" && cfg.diagnostics != "json" && cfg.diagnostics != "sarif" {
+		fmt.Fprintf(stderr, "golibsass: invalid diagnostics format %q, must be json or sarif\n", cfg.diagnostics)
+		return exitUsageError
+	}
+
+	var diags []diagnostics.Diagnostic
+	collect := func(result libsass.Result, err error) {
+		diags = append(diags, diagnostics.Collect(result, err)...)
+	}
+
+	err := compile(ctx, cfg, positional, stdin, stdout, stderr, collect)
+	if cfg.diagnostics != "" && !cfg.watch {
+		if werr := writeDiagnostics(cfg, diags, stderr); werr != nil && err == nil {
+			err = ioError{werr}
+		}
+	}
+	if err == nil {
+		return exitOK
+	}
+
+	var (
+		uerr usageError
+		ierr ioError
+	)
+	switch {
+	case errors.As(err, &uerr):
+		fmt.Fprintf(stderr, "golibsass: %s\n", err)
+		return exitUsageError
+	case errors.As(err, &ierr):
+		fmt.Fprintf(stderr, "golibsass: %s\n", err)
+		return exitIOError
+	}
+	// With --diagnostics, compile errors are in the report.
+	if cfg.diagnostics == "" {
+		fmt.Fprintf(stderr, "golibsass: %s\n", err)
+	}
+	return exitCompileError
+}
+
+// writeDiagnostics writes diags as a report in the format given by
+// --diagnostics.
+func writeDiagnostics(cfg config, diags []diagnostics.Diagnostic, w io.Writer) error {
+	report := diagnostics.NewReport(diags...)
+	var (
+		b   []byte
+		err error
+	)
+	if cfg.diagnostics == "sarif" {
+		b, err = report.SARIF()
+	} else {
+		b, err = report.JSON()
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// compile compiles the input given in args, collect is called with the
+// outcome of each compilation.
+func compile(ctx context.Context, cfg config, args []string, stdin io.Reader, stdout, stderr io.Writer, collect func(libsass.Result, error)) error {
+	if len(args) > 2 {
+		return usageError{"too many arguments"}
+	}
+	input, output := "-", ""
+	if len(args) > 0 {
+		input = args[0]
+	}
+	if len(args) > 1 {
+		output = args[1]
+	}
+	if cfg.stdin {
+		if len(args) > 1 {
+			return usageError{"too many arguments"}
+		}
+		input, output = "-", ""
+		if len(args) > 0 {
+			output = args[0]
+		}
+	}
+
+	if style := libsass.ParseOutputStyle(cfg.style); style == libsass.NestedStyle && !strings.EqualFold(cfg.style, "nested") {
+		return usageError{fmt.Sprintf("invalid output style %q", cfg.style)}
+	}
+	if cfg.sourceMap == "auto" && output == "" {
+		return usageError{"--sourcemap=auto requires an OUTPUT file"}
+	}
+
+	if input == "-" {
+		if cfg.watch {
+			return usageError{"--watch requires an INPUT file or directory"}
+		}
+		b, err := io.ReadAll(stdin)
+		if err != nil {
+			return ioError{err}
+		}
+		return compileSource(cfg, string(b), output, stdout, collect)
+	}
+
+	fi, err := os.Stat(input)
+	if err != nil {
+		return ioError{err}
+	}
+
+	jobs := []job{{input: input, output: output}}
+	if fi.IsDir() {
+		if output == "" {
+			return usageError{"compiling a directory requires an OUTPUT directory"}
+		}
+		if jobs, err = dirJobs(input, output); err != nil {
+			return ioError{err}
+		}
+	}
+
+	if cfg.watch {
+		if output == "" {
+			return usageError{"--watch requires an OUTPUT file or directory"}
+		}
+		if fi.IsDir() {
+			return watchDir(ctx, cfg, input, output, stdout, stderr)
+		}
+		return watchJobs(ctx, cfg, watch.Config{Entries: []watch.Entry{cfg.entry(jobs[0])}}, stdout, stderr)
+	}
+
+	var errs []error
+	for _, j := range jobs {
+		if err := compileFile(cfg, j, stdout, collect); err != nil {
+			if len(jobs) == 1 {
+				return err
+			}
+			// With --diagnostics, compile errors are in the report.
+			var ierr ioError
+			if cfg.diagnostics == "" || errors.As(err, &ierr) {
+				fmt.Fprintf(stderr, "golibsass: %s: %s\n", j.input, err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return batchError{errs: errs, total: len(jobs)}
+	}
+	return nil
+}
+
+// batchError is the error from compiling a directory. The errors of the
+// files are reported as they fail, so it only summarizes them.
+type batchError struct {
+	errs  []error
+	total int
+}
+
+func (e batchError) Error() string {
+	return fmt.Sprintf("%d of %d files failed", len(e.errs), e.total)
+}
+
+func (e batchError) Unwrap() []error { return e.errs }
+
+// job is a file to compile.
+type job struct {
+	input string
+
+	// Empty for stdout.
+	output string
+}
+
+// dirJobs returns the jobs to compile all non-partial Sass files in dir
+// to outDir.
+func dirJobs(dir, outDir string) ([]job, error) {
+	var jobs []job
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		ext := filepath.Ext(path)
+		if (ext != ".scss" && ext != ".sass") || strings.HasPrefix(d.Name(), "_") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, job{
+			input:  path,
+			output: filepath.Join(outDir, strings.TrimSuffix(rel, ext)+".css"),
+		})
+		return nil
+	})
+	return jobs, err
+}
+
+// options returns the options to compile the given input to output.
+func (cfg config) options(input, output string) libsass.Options {
+	opts := libsass.Options{
+		OutputStyle:    libsass.ParseOutputStyle(cfg.style),
+		Precision:      cfg.precision,
+		IncludePaths:   cfg.loadPaths,
+		SassSyntax:     cfg.sass,
+		SourceComments: cfg.lineComments,
+	}
+
+	if cfg.sourceMap != "" {
+		opts.SourceMapOptions = libsass.SourceMapOptions{
+			InputPath:      input,
+			OutputPath:     output,
+			Contents:       cfg.mapContents,
+			Root:           cfg.mapRoot,
+			OmitURL:        cfg.omitMapComment,
+			FileURLs:       cfg.mapFileURLs,
+			EnableEmbedded: cfg.sourceMap == "inline",
+		}
+		if output != "" {
+			opts.SourceMapOptions.Filename = output + ".map"
+		}
+	}
+	return opts
+}
+
+func compileSource(cfg config, src, output string, stdout io.Writer, collect func(libsass.Result, error)) error {
+	transpiler, err := libsass.New(cfg.options("stdin", output))
+	if err != nil {
+		return usageError{err.Error()}
+	}
+	result, err := transpiler.Execute(src)
+	collect(result, err)
+	if err != nil {
+		return err
+	}
+	return writeResult(cfg, result, output, stdout)
+}
+
+func compileFile(cfg config, j job, stdout io.Writer, collect func(libsass.Result, error)) error {
+	transpiler, err := libsass.New(cfg.options(j.input, j.output))
+	if err != nil {
+		return usageError{err.Error()}
+	}
+	result, err := transpiler.ExecuteFile(j.input)
+	collect(result, err)
+	if err != nil {
+		return err
+	}
+	return writeResult(cfg, result, j.output, stdout)
+}
+
+func writeResult(cfg config, result libsass.Result, output string, stdout io.Writer) error {
+	if output == "" {
+		if _, err := io.WriteString(stdout, result.CSS); err != nil {
+			return ioError{err}
+		}
+		return nil
+	}
+	if err := writeFile(output, result.CSS); err != nil {
+		return err
+	}
+	if cfg.sourceMap == "auto" && result.SourceMapContent != "" {
+		return writeFile(output+".map", result.SourceMapContent)
+	}
+	return nil
+}
+
+func writeFile(filename, content string) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return ioError{err}
+	}
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		return ioError{err}
+	}
+	return nil
+}
+
+// entry returns the watch entry for j.
+func (cfg config) entry(j job) watch.Entry {
+	entry := watch.Entry{Filename: j.input, Target: j.output}
+	if cfg.sourceMap != "" {
+		// The source map options depend on the input and output.
+		opts := cfg.options(j.input, j.output)
+		entry.Options = &opts
+		if cfg.sourceMap == "auto" {
+			entry.SourceMapTarget = j.output + ".map"
+		}
+	}
+	return entry
+}
+
+// watchDir compiles the Sass files in dir to outDir and recompiles them on
+// changes until ctx is done. New files in dir are compiled too.
+func watchDir(ctx context.Context, cfg config, dir, outDir string, stdout, stderr io.Writer) error {
+	return watchJobs(ctx, cfg, watch.Config{
+		Dirs: []string{dir},
+		Find: func() ([]watch.Entry, error) {
+			jobs, err := dirJobs(dir, outDir)
+			if err != nil {
+				return nil, err
+			}
+			entries := make([]watch.Entry, len(jobs))
+			for i, j := range jobs {
+				entries[i] = cfg.entry(j)
+			}
+			return entries, nil
+		},
+	}, stdout, stderr)
+}
+
+// watchJobs compiles the entries in wcfg and recompiles them on changes until
+// ctx is done.
+func watchJobs(ctx context.Context, cfg config, wcfg watch.Config, stdout, stderr io.Writer) error {
+	wcfg.Options = cfg.options("", "")
+	events, err := watch.Watch(ctx, wcfg)
+	if err != nil {
+		return usageError{err.Error()}
+	}
+
+	for e := range events {
+		if cfg.diagnostics != "" {
+			// One report per compilation.
+			if err := writeDiagnostics(cfg, diagnostics.Collect(e.Result, e.Err), stderr); err != nil {
+				fmt.Fprintf(stderr, "golibsass: %s\n", err)
+			}
+		}
+		switch {
+		case e.Err == nil:
+			fmt.Fprintf(stdout, "Compiled %s to %s\n", e.Entry.Filename, e.Entry.Target)
+		case cfg.diagnostics != "":
+			// In the report.
+		case e.Entry.Filename == "":
+			fmt.Fprintf(stderr, "golibsass: %s\n", e.Err)
+		default:
+			fmt.Fprintf(stderr, "golibsass: %s: %s\n", e.Entry.Filename, e.Err)
+		}
+	}
+	return nil
+}
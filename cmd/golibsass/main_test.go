@@ -0,0 +1,180 @@
+// Copyright © 2022 Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bep/golibsass/libsass/diagnostics"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestRun(t *testing.T) {
+	c := qt.New(t)
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		filename := filepath.Join(dir, name)
+		c.Assert(os.MkdirAll(filepath.Dir(filename), 0o755), qt.IsNil)
+		c.Assert(os.WriteFile(filename, []byte(content), 0o644), qt.IsNil)
+		return filename
+	}
+	readFile := func(filename string) string {
+		b, err := os.ReadFile(filename)
+		c.Assert(err, qt.IsNil)
+		return string(b)
+	}
+	runArgs := func(stdin string, args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+		return code, stdout.String(), stderr.String()
+	}
+
+	waitFor := func(filename, want string) {
+		for i := 0; i < 100; i++ {
+			if b, err := os.ReadFile(filename); err == nil && string(b) == want {
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		c.Fatalf("timed out waiting for %q in %s", want, filename)
+	}
+
+	writeFile("src/_colors.scss", `$primary: #ccc;`)
+	main := writeFile("src/main.scss", `@import "colors"; a { color: $primary; }`)
+	writeFile("src/sub/other.sass", "b\n  color: red\n")
+	writeFile("lib/_mixins.scss", `@mixin big { font-size: 2em; }`)
+
+	c.Run("stdin", func(c *qt.C) {
+		code, stdout, _ := runArgs("@import 'mixins'; a { @include big; }", "-s", "-t", "compressed", "-I", filepath.Join(dir, "lib"))
+		c.Assert(code, qt.Equals, exitOK)
+		c.Assert(stdout, qt.Equals, "a{font-size:2em}\n")
+
+		code, stdout, _ = runArgs("a\n  color: red\n", "--sass", "--style=compact")
+		c.Assert(code, qt.Equals, exitOK)
+		c.Assert(stdout, qt.Equals, "a { color: red; }\n")
+	})
+
+	c.Run("file", func(c *qt.C) {
+		out := filepath.Join(dir, "out", "main.css")
+		code, _, stderr := runArgs("", main, out, "-t", "compressed", "--sourcemap")
+		c.Assert(code, qt.Equals, exitOK, qt.Commentf(stderr))
+		c.Assert(readFile(out), qt.Equals, "a{color:#ccc}\n\n/*# sourceMappingURL=main.css.map */")
+		c.Assert(readFile(out+".map"), qt.Contains, `"../src/_colors.scss"`)
+
+		code, stdout, _ := runArgs("", "-m=inline", "-t", "compressed", main)
+		c.Assert(code, qt.Equals, exitOK)
+		c.Assert(stdout, qt.Contains, "sourceMappingURL=data:application/json;base64,")
+	})
+
+	c.Run("dir", func(c *qt.C) {
+		out := filepath.Join(dir, "dist")
+		code, _, _ := runArgs("", "-t", "compressed", filepath.Join(dir, "src"), out)
+		c.Assert(code, qt.Equals, exitOK)
+		c.Assert(readFile(filepath.Join(out, "main.css")), qt.Equals, "a{color:#ccc}\n")
+		c.Assert(readFile(filepath.Join(out, "sub", "other.css")), qt.Equals, "b{color:red}\n")
+		_, err := os.Stat(filepath.Join(out, "_colors.css"))
+		c.Assert(os.IsNotExist(err), qt.IsTrue)
+
+		// Each failing file is reported once, followed by a summary.
+		writeFile("bad/a.scss", "a {")
+		writeFile("bad/b.scss", "b { color: red; }")
+		writeFile("bad/c.scss", "c { color: $nope; }")
+		code, _, stderr := runArgs("", filepath.Join(dir, "bad"), filepath.Join(dir, "bad-dist"))
+		c.Assert(code, qt.Equals, exitCompileError)
+		c.Assert(strings.Count(stderr, `Invalid CSS after "a {"`), qt.Equals, 1)
+		c.Assert(strings.Count(stderr, "Undefined variable"), qt.Equals, 1)
+		c.Assert(stderr, qt.Contains, "golibsass: "+filepath.Join(dir, "bad", "c.scss")+": ")
+		c.Assert(strings.HasSuffix(stderr, "golibsass: 2 of 3 files failed\n"), qt.IsTrue)
+		c.Assert(readFile(filepath.Join(dir, "bad-dist", "b.css")), qt.Equals, "b {\n  color: red; }\n")
+	})
+
+	c.Run("exit codes", func(c *qt.C) {
+		code, _, stderr := runArgs("a {")
+		c.Assert(code, qt.Equals, exitCompileError)
+		c.Assert(stderr, qt.Contains, `Invalid CSS after "a {"`)
+
+		code, _, _ = runArgs("", filepath.Join(dir, "missing.scss"))
+		c.Assert(code, qt.Equals, exitIOError)
+
+		code, _, _ = runArgs("", main, filepath.Join(dir, "src", "main.scss", "out.css"))
+		c.Assert(code, qt.Equals, exitIOError)
+
+		code, _, _ = runArgs("", "--nosuchflag")
+		c.Assert(code, qt.Equals, exitUsageError)
+
+		code, _, _ = runArgs("", "-t", "bogus", main)
+		c.Assert(code, qt.Equals, exitUsageError)
+
+		code, _, _ = runArgs("", "--sourcemap", main)
+		c.Assert(code, qt.Equals, exitUsageError)
+	})
+
+	c.Run("diagnostics", func(c *qt.C) {
+		broken := writeFile("src/broken.scss", "@warn \"careful\";\n@import \"colors\";\na { color: $nope; }\n")
+
+		code, _, stderr := runArgs("", "--diagnostics=json", broken)
+		c.Assert(code, qt.Equals, exitCompileError)
+		var report diagnostics.Report
+		c.Assert(json.Unmarshal([]byte(stderr), &report), qt.IsNil)
+		c.Assert(report.Version, qt.Equals, diagnostics.Version)
+		c.Assert(report.Diagnostics, qt.HasLen, 2)
+		c.Assert(report.Diagnostics[0].Severity, qt.Equals, diagnostics.SeverityWarning)
+		c.Assert(report.Diagnostics[1].Severity, qt.Equals, diagnostics.SeverityError)
+		c.Assert(report.Diagnostics[1].File, qt.Equals, broken)
+		c.Assert(report.Diagnostics[1].Range.Start, qt.Equals, diagnostics.Position{Line: 3, Column: 12})
+
+		code, _, stderr = runArgs("", "--diagnostics", "sarif", main)
+		c.Assert(code, qt.Equals, exitOK)
+		c.Assert(stderr, qt.Contains, `"version": "2.1.0"`)
+		c.Assert(stderr, qt.Contains, `"results": []`)
+
+		code, _, _ = runArgs("", "--diagnostics=xml", main)
+		c.Assert(code, qt.Equals, exitUsageError)
+		c.Assert(os.Remove(broken), qt.IsNil)
+	})
+
+	c.Run("watch", func(c *qt.C) {
+		out := filepath.Join(dir, "watch", "main.css")
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan int)
+		go func() {
+			var stdout, stderr bytes.Buffer
+			done <- run(ctx, []string{"-w", "-t", "compressed", main, out}, nil, &stdout, &stderr)
+		}()
+
+		waitFor(out, "a{color:#ccc}\n")
+		writeFile("src/_colors.scss", `$primary: #ddd;`)
+		waitFor(out, "a{color:#ddd}\n")
+
+		cancel()
+		c.Assert(<-done, qt.Equals, exitOK)
+	})
+
+	c.Run("watch dir", func(c *qt.C) {
+		out := filepath.Join(dir, "watchdir")
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan int)
+		go func() {
+			var stdout, stderr bytes.Buffer
+			done <- run(ctx, []string{"-w", "-t", "compressed", "--sourcemap", filepath.Join(dir, "src"), out}, nil, &stdout, &stderr)
+		}()
+
+		waitFor(filepath.Join(out, "sub", "other.css"), "b{color:red}\n\n/*# sourceMappingURL=other.css.map */")
+		writeFile("src/new/third.scss", `c { color: blue; }`)
+		waitFor(filepath.Join(out, "new", "third.css"), "c{color:blue}\n\n/*# sourceMappingURL=third.css.map */")
+		c.Assert(readFile(filepath.Join(out, "new", "third.css.map")), qt.Contains, `"../../src/new/third.scss"`)
+
+		cancel()
+		c.Assert(<-done, qt.Equals, exitOK)
+	})
+}
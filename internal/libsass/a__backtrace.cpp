@@ -0,0 +1,86 @@
+// Copyright © 2022 Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// When LibSass throws an error, the mixin and function calls leading to it are
+// left on the backtrace and the callee stack. This returns them, the
+// innermost first.
+//
+// The names are taken from the backtrace, which owns them; the names on the
+// callee stack may point into AST nodes freed while unwinding.
+
+#include <cstddef>
+
+struct golibsass_frame {
+  char* name;
+  char* path;
+  size_t line;
+  size_t column;
+  int type;
+};
+
+#ifndef USE_LIBSASS_SRC
+#include "../../libsass_src/src/sass.hpp"
+
+#include <cstdlib>
+
+#include "../../libsass_src/src/backtrace.hpp"
+#include "../../libsass_src/src/context.hpp"
+#include "../../libsass_src/src/sass_context.hpp"
+#include "../../libsass_src/src/sass_functions.hpp"
+
+extern "C" struct golibsass_frame* golibsass_compiler_get_backtrace(struct Sass_Compiler* compiler, size_t* size)
+{
+  Sass::Context* cpp_ctx = compiler->cpp_ctx;
+  const Sass::Backtraces& traces = cpp_ctx->traces;
+  const Sass::sass::vector<Sass_Callee>& callees = cpp_ctx->callee_stack;
+
+  struct frame {
+    Sass::sass::string name;
+    Sass::sass::string path;
+    size_t line;
+    size_t column;
+    int type;
+  };
+  Sass::sass::vector<frame> frames;
+
+  // Calls have a caller like ", in mixin `name`", and a callee pushed
+  // with the same position, in the same order.
+  size_t c = 0;
+  for (size_t i = 0, S = traces.size(); i < S; ++i) {
+    const Sass::Backtrace& trace = traces[i];
+    size_t beg = trace.caller.find('`');
+    size_t end = trace.caller.rfind('`');
+    if (beg == Sass::sass::string::npos || end <= beg) continue;
+    size_t line = trace.pstate.getLine();
+    size_t column = trace.pstate.getColumn();
+    while (c < callees.size() && (callees[c].line != line || callees[c].column != column)) ++c;
+    if (c == callees.size()) break;
+    frames.push_back({ trace.caller.substr(beg + 1, end - beg - 1), trace.pstate.getPath(), line, column, callees[c].type });
+    ++c;
+  }
+
+  *size = frames.size();
+  struct golibsass_frame* result = (struct golibsass_frame*) calloc(frames.size(), sizeof(struct golibsass_frame));
+  for (size_t i = 0, S = frames.size(); i < S; ++i) {
+    const frame& f = frames[S - i - 1];
+    result[i].name = sass_copy_c_string(f.name.c_str());
+    result[i].path = sass_copy_c_string(f.path.c_str());
+    result[i].line = f.line;
+    result[i].column = f.column;
+    result[i].type = f.type;
+  }
+  return result;
+}
+#else
+#include <cstdlib>
+#include <sass/context.h>
+
+// Linking against a system LibSass, the backtrace is not available.
+extern "C" struct golibsass_frame* golibsass_compiler_get_backtrace(struct Sass_Compiler* compiler, size_t* size)
+{
+  *size = 0;
+  return nullptr;
+}
+#endif
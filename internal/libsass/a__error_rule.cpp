@@ -0,0 +1,74 @@
+// Copyright © 2022 Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// LibSass goes on with the next statement after calling a custom @error
+// function. This wraps the function to raise the error with the message it
+// returns, as LibSass does for @error rules without one.
+
+#include <sass/context.h>
+
+extern "C" union Sass_Value* SassFunction(const union Sass_Value* args, Sass_Function_Entry cb, struct Sass_Compiler* comp);
+
+#ifndef USE_LIBSASS_SRC
+#include "../../libsass_src/src/sass.hpp"
+
+#include "../../libsass_src/src/context.hpp"
+#include "../../libsass_src/src/error_handling.hpp"
+#include "../../libsass_src/src/position.hpp"
+#include "../../libsass_src/src/sass_context.hpp"
+#include "../../libsass_src/src/sass_functions.hpp"
+#include "../../libsass_src/src/source.hpp"
+
+namespace {
+
+  Sass::sass::string error_message(union Sass_Value* result)
+  {
+    if (sass_value_is_error(result)) return sass_error_get_message(result);
+    if (sass_value_is_string(result)) return sass_string_get_value(result);
+    return "";
+  }
+
+}
+
+extern "C" union Sass_Value* golibsass_error_function(const union Sass_Value* args, Sass_Function_Entry cb, struct Sass_Compiler* compiler)
+{
+  union Sass_Value* result = SassFunction(args, cb, compiler);
+  Sass::sass::string msg = error_message(result);
+  sass_delete_value(result);
+
+  // The @error rule is the last callee, LibSass pops it when the function
+  // returns.
+  Sass::Context* cpp_ctx = compiler->cpp_ctx;
+  Sass_Callee callee = cpp_ctx->callee_stack.back();
+  Sass::sass::string path(callee.path);
+  cpp_ctx->callee_stack.pop_back();
+
+  // Find the source of the rule to show it in the error.
+  for (size_t i = cpp_ctx->included_files.size(); i > 0; --i) {
+    if (cpp_ctx->included_files[i - 1] == path) {
+      Sass::SourceFileObj source = SASS_MEMORY_NEW(Sass::SourceFile,
+        path.c_str(), cpp_ctx->resources[i - 1].contents, i - 1);
+      Sass::error(msg, Sass::SourceSpan(source, Sass::Offset(callee.line - 1, callee.column - 1)), cpp_ctx->traces);
+    }
+  }
+  // The path is owned by the parsed source.
+  Sass::error(msg, Sass::SourceSpan(callee.path), cpp_ctx->traces);
+  return nullptr;
+}
+#else
+#include <stdexcept>
+#include <string>
+
+// Linking against a system LibSass, the error is raised without its position.
+extern "C" union Sass_Value* golibsass_error_function(const union Sass_Value* args, Sass_Function_Entry cb, struct Sass_Compiler* compiler)
+{
+  union Sass_Value* result = SassFunction(args, cb, compiler);
+  std::string msg;
+  if (sass_value_is_error(result)) msg = sass_error_get_message(result);
+  else if (sass_value_is_string(result)) msg = sass_string_get_value(result);
+  sass_delete_value(result);
+  throw std::runtime_error(msg);
+}
+#endif
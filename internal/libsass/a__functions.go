@@ -0,0 +1,99 @@
+// Copyright © 2022 Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package libsass
+
+// #include <stdint.h>
+// #include "stdlib.h"
+// #include "sass/context.h"
+//
+// extern union Sass_Value* BridgeFunction(union Sass_Value* args, uintptr_t i, struct Sass_Compiler* comp);
+//
+// union Sass_Value* SassFunction(const union Sass_Value* args, Sass_Function_Entry cb, struct Sass_Compiler* comp)
+// {
+//   uintptr_t ci = (uintptr_t)sass_function_get_cookie(cb);
+//   return BridgeFunction((union Sass_Value*)args, ci, comp);
+// }
+//
+// Sass_Function_Entry SassMakeFunction(const char* signature, uintptr_t ci)
+// {
+//   return sass_make_function(signature, SassFunction, (void*)ci);
+// }
+//
+// extern union Sass_Value* golibsass_error_function(const union Sass_Value* args, Sass_Function_Entry cb, struct Sass_Compiler* comp);
+//
+// Sass_Function_Entry SassMakeErrorFunction(const char* signature, uintptr_t ci)
+// {
+//   return sass_make_function(signature, golibsass_error_function, (void*)ci);
+// }
+import "C"
+
+import (
+	"sort"
+	"strings"
+	"unsafe"
+
+	"github.com/bep/golibsass/libsass/sassvalue"
+)
+
+var functionsStore = &idMap{
+	m: make(map[int]interface{}),
+	i: uintptrOffset,
+}
+
+// Function is a custom Sass function implemented in Go.
+// The callee is the call site of the function.
+type Function func(callee Callee, args []sassvalue.Value) (sassvalue.Value, error)
+
+// Callee is an entry in the LibSass call stack.
+type Callee struct {
+	Name   string
+	Path   string
+	Line   int
+	Column int
+}
+
+// AddFunctions registers the given functions, keyed by their Sass signature,
+// e.g. "asset-url($path, $fallback: null)", in LibSASS.
+// The special signatures "@warn($message)", "@debug($message)" and
+// "@error($message)" can be used to handle those directives.
+// The @error function returns the message of the error, which fails the
+// compilation as without it, see a__error_rule.cpp.
+// Make sure to call DeleteFunctions with the returned IDs when done.
+func AddFunctions(opts SassOptions, funcs map[string]Function) []int {
+	signatures := make([]string, 0, len(funcs))
+	for signature := range funcs {
+		signatures = append(signatures, signature)
+	}
+	sort.Strings(signatures)
+
+	ids := make([]int, len(signatures))
+	list := C.sass_make_function_list(C.size_t(len(signatures)))
+	for i, signature := range signatures {
+		ids[i] = functionsStore.Set(funcs[signature])
+		csignature := C.CString(signature)
+		var entry C.Sass_Function_Entry
+		if strings.HasPrefix(signature, "@error(") {
+			entry = C.SassMakeErrorFunction(csignature, C.uintptr_t(ids[i]))
+		} else {
+			entry = C.SassMakeFunction(csignature, C.uintptr_t(ids[i]))
+		}
+		C.sass_function_set_list_entry(list, C.size_t(i), entry)
+		C.free(unsafe.Pointer(csignature))
+	}
+
+	C.sass_option_set_c_functions(
+		(*C.struct_Sass_Options)(unsafe.Pointer(opts)),
+		list,
+	)
+
+	return ids
+}
+
+// DeleteFunctions removes the functions registered with AddFunctions.
+func DeleteFunctions(ids []int) {
+	for _, id := range ids {
+		functionsStore.Delete(id)
+	}
+}
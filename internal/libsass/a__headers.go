@@ -0,0 +1,60 @@
+// Copyright © 2022 Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package libsass
+
+// #include <stdint.h>
+// #include "sass/context.h"
+//
+// extern struct Sass_Import** BridgeHeaders(uintptr_t i);
+//
+// Sass_Import_List SassHeaders(const char* currPath, Sass_Importer_Entry imp, struct Sass_Compiler* comp)
+// {
+//   uintptr_t ci = (uintptr_t)sass_importer_get_cookie(imp);
+//   return BridgeHeaders(ci);
+// }
+//
+// Sass_Importer_Entry SassMakeHeaders(uintptr_t ci)
+// {
+//   return sass_make_importer(SassHeaders, 0, (void*)ci);
+// }
+import "C"
+
+import "unsafe"
+
+var headersStore = &idMap{
+	m: make(map[int]interface{}),
+	i: uintptrOffset,
+}
+
+// Header is a stylesheet LibSass imports before the entry's source.
+type Header struct {
+	// The path used in error messages and source maps, or the path to load
+	// the header from if Body is empty.
+	Path string
+
+	// The header's source.
+	Body string
+}
+
+// AddHeaders registers the given headers in LibSASS.
+// Make sure to call DeleteHeaders with the returned ID when done.
+func AddHeaders(opts SassOptions, headers []Header) int {
+	i := headersStore.Set(headers)
+
+	list := C.sass_make_importer_list(1)
+	C.sass_importer_set_list_entry(list, 0, C.SassMakeHeaders(C.uintptr_t(i)))
+
+	C.sass_option_set_c_headers(
+		(*C.struct_Sass_Options)(unsafe.Pointer(opts)),
+		list,
+	)
+
+	return i
+}
+
+// DeleteHeaders removes the headers registered with AddHeaders.
+func DeleteHeaders(i int) {
+	headersStore.Delete(i)
+}
@@ -7,15 +7,13 @@ package libsass
 // #include <stdint.h>
 // #include "sass/context.h"
 //
-// extern struct Sass_Import** BridgeImport(const char* currPath, const char* prevPath, int i);
+// extern struct Sass_Import** BridgeImport(const char* currPath, struct Sass_Compiler* comp, int i);
 //
 // Sass_Import_List SassImport(const char* currPath, Sass_Importer_Entry imp, struct Sass_Compiler* comp)
 // {
 //   void* c = sass_importer_get_cookie(imp);
 //   uintptr_t ci = (uintptr_t)c;
-//   struct Sass_Import* prevPath = sass_compiler_get_last_import(comp);
-//   const char* prev_path = sass_import_get_imp_path(prevPath);
-//   return BridgeImport(currPath, prev_path, ci);
+//   return BridgeImport(currPath, comp, ci);
 // }
 import "C"
 
@@ -67,8 +65,19 @@ func DeleteImportResolver(i int) error {
 
 // ImportResolver can be used as a custom import resolver.
 // Return an empty body to load the import body from the path.
+// A non-nil error will abort the compilation with an error at the @import site.
 // See AddImportResolver.
-type ImportResolver func(currPath string, prevPath string) (newPath string, body string, resolved bool)
+// The stack starts with the entry and ends with the importing file.
+type ImportResolver func(currPath string, stack []Import) (newPath string, body string, resolved bool, err error)
+
+// Import is an entry in the LibSass import stack.
+type Import struct {
+	// The path as written in the @import.
+	ImpPath string
+
+	// The resolved path, e.g. the path returned from an ImportResolver.
+	AbsPath string
+}
 
 type idMap struct {
 	sync.RWMutex
@@ -0,0 +1,149 @@
+// Copyright © 2022 Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// LibSass does not keep track of which file imported which, this collects
+// the @import statements from the parsed style sheets and, after a syntax
+// error, from the files still being parsed.
+// It also tells whether a compilation failed while parsing.
+
+#include <cstddef>
+
+struct golibsass_import {
+  char* path;
+  char* parent;
+  size_t line;
+  size_t column;
+};
+
+#ifndef USE_LIBSASS_SRC
+#include "../../libsass_src/src/sass.hpp"
+
+#include <algorithm>
+#include <cstdlib>
+#include <cstring>
+
+#include "../../libsass_src/src/ast.hpp"
+#include "../../libsass_src/src/context.hpp"
+#include "../../libsass_src/src/sass_context.hpp"
+#include "../../libsass_src/src/sass_functions.hpp"
+
+namespace {
+
+  struct import_site {
+    Sass::sass::string path;
+    Sass::sass::string parent;
+    size_t line;
+    size_t column;
+  };
+
+  // The stubs are positioned at the last URL of the @import statement,
+  // this moves back to the @import keyword as in the backtraces.
+  import_site make_site(Sass::Import_Stub* stub)
+  {
+    const Sass::SourceSpan& pstate = stub->pstate();
+    import_site site = { stub->abs_path(), pstate.getPath(), pstate.getLine(), pstate.getColumn() };
+    const char* data = pstate.getRawData();
+    if (data == nullptr) return site;
+
+    size_t line = 1, pos = 0, len = std::strlen(data);
+    while (pos < len && line < site.line) {
+      if (data[pos++] == '\n') ++line;
+    }
+    pos += site.column - 1;
+    const char* keyword = "@import";
+    size_t klen = std::strlen(keyword);
+    while (pos + klen > len && pos > 0) --pos;
+    for (;; --pos) {
+      if (std::strncmp(data + pos, keyword, klen) == 0) {
+        site.line = 1 + std::count(data, data + pos, '\n');
+        size_t bol = pos;
+        while (bol > 0 && data[bol - 1] != '\n') --bol;
+        site.column = pos - bol + 1;
+        break;
+      }
+      if (pos == 0) break;
+    }
+    return site;
+  }
+
+  void collect_imports(Sass::Block* block, Sass::sass::vector<import_site>& imports)
+  {
+    if (block == nullptr) return;
+    for (size_t i = 0, S = block->length(); i < S; ++i) {
+      Sass::Statement* stm = block->at(i);
+      if (Sass::Import_Stub* stub = Sass::Cast<Sass::Import_Stub>(stm)) {
+        imports.push_back(make_site(stub));
+      }
+      else if (Sass::ParentStatement* parent = Sass::Cast<Sass::ParentStatement>(stm)) {
+        // Nested imports, e.g. inside a rule.
+        collect_imports(parent->block(), imports);
+      }
+    }
+  }
+
+  // A file is added to the sheets when parsed, so the last file on the
+  // import stack is missing if parsing failed.
+  // The first entry on the stack is pushed for the entry only.
+  bool failed_parsing(Sass::Context* cpp_ctx)
+  {
+    if (cpp_ctx->import_stack.size() < 2) return false;
+    return cpp_ctx->sheets.count(cpp_ctx->import_stack.back()->abs_path) == 0;
+  }
+
+}
+
+extern "C" int golibsass_compiler_failed_parsing(struct Sass_Compiler* compiler)
+{
+  return failed_parsing(compiler->cpp_ctx);
+}
+
+extern "C" struct golibsass_import* golibsass_compiler_get_imports(struct Sass_Compiler* compiler, size_t* size)
+{
+  Sass::Context* cpp_ctx = compiler->cpp_ctx;
+  Sass::sass::vector<import_site> imports;
+
+  // In import order, so a file imported more than once is listed first
+  // with its first import.
+  for (size_t i = 0, S = cpp_ctx->included_files.size(); i < S; ++i) {
+    auto it = cpp_ctx->sheets.find(cpp_ctx->included_files[i]);
+    if (it != cpp_ctx->sheets.end()) collect_imports(it->second.root, imports);
+  }
+
+  // The files still being parsed when a syntax error was thrown are left on
+  // the import stack, and the @import statements on the backtrace.
+  size_t nested = failed_parsing(cpp_ctx) ? cpp_ctx->import_stack.size() - 2 : 0;
+  if (nested > 0 && cpp_ctx->traces.size() >= nested) {
+    for (size_t i = 0; i < nested; ++i) {
+      const Sass::SourceSpan& pstate = cpp_ctx->traces[i].pstate;
+      imports.push_back({ cpp_ctx->import_stack[i + 2]->abs_path, pstate.getPath(), pstate.getLine(), pstate.getColumn() });
+    }
+  }
+
+  *size = imports.size();
+  struct golibsass_import* result = (struct golibsass_import*) calloc(imports.size(), sizeof(struct golibsass_import));
+  for (size_t i = 0, S = imports.size(); i < S; ++i) {
+    result[i].path = sass_copy_c_string(imports[i].path.c_str());
+    result[i].parent = sass_copy_c_string(imports[i].parent.c_str());
+    result[i].line = imports[i].line;
+    result[i].column = imports[i].column;
+  }
+  return result;
+}
+#else
+#include <cstdlib>
+#include <sass/context.h>
+
+// Linking against a system LibSass, the import sites are not available.
+extern "C" int golibsass_compiler_failed_parsing(struct Sass_Compiler* compiler)
+{
+  return 0;
+}
+
+extern "C" struct golibsass_import* golibsass_compiler_get_imports(struct Sass_Compiler* compiler, size_t* size)
+{
+  *size = 0;
+  return nullptr;
+}
+#endif
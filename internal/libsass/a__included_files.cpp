@@ -0,0 +1,56 @@
+// Copyright © 2022 Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// LibSass' sass_context_get_included_files returns the included files sorted
+// by name, this returns them in the order they were imported.
+
+#ifndef USE_LIBSASS_SRC
+#include "../../libsass_src/src/sass.hpp"
+
+#include <algorithm>
+#include <cstdlib>
+#include <cstring>
+
+#include "../../libsass_src/src/context.hpp"
+#include "../../libsass_src/src/sass_context.hpp"
+
+extern "C" char** golibsass_compiler_get_included_files(struct Sass_Compiler* compiler, size_t* size)
+{
+  Sass::Context* cpp_ctx = compiler->cpp_ctx;
+  // The entry of a data context is not a file.
+  bool skip = compiler->c_ctx->type == SASS_CONTEXT_DATA;
+
+  Sass::sass::vector<Sass::sass::string> includes;
+  for (size_t i = 0, S = cpp_ctx->included_files.size(); i < S; ++i) {
+    if (i == 0 && skip) continue;
+    const Sass::sass::string& path = cpp_ctx->included_files[i];
+    if (std::find(includes.begin(), includes.end(), path) != includes.end()) continue;
+    includes.push_back(path);
+  }
+
+  *size = includes.size();
+  char** files = (char**) calloc(includes.size(), sizeof(char*));
+  for (size_t i = 0, S = includes.size(); i < S; ++i) {
+    files[i] = sass_copy_c_string(includes[i].c_str());
+  }
+  return files;
+}
+#else
+#include <cstdlib>
+#include <sass/context.h>
+
+// Linking against a system LibSass, fall back to the sorted list.
+extern "C" char** golibsass_compiler_get_included_files(struct Sass_Compiler* compiler, size_t* size)
+{
+  struct Sass_Context* ctx = sass_compiler_get_context(compiler);
+  *size = sass_context_get_included_files_size(ctx);
+  char** included = sass_context_get_included_files(ctx);
+  char** files = (char**) calloc(*size, sizeof(char*));
+  for (size_t i = 0; i < *size; ++i) {
+    files[i] = sass_copy_c_string(included[i]);
+  }
+  return files;
+}
+#endif
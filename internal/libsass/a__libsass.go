@@ -4,27 +4,72 @@
 // license that can be found in the LICENSE file.
 package libsass
 
+// #include <stdint.h>
 // #include "stdlib.h"
 // #include "sass/context.h"
 // #include "sass2scss.h"
+//
+// char** golibsass_compiler_get_included_files(struct Sass_Compiler* compiler, size_t* size);
+//
+// struct golibsass_import {
+//   char* path;
+//   char* parent;
+//   size_t line;
+//   size_t column;
+// };
+// struct golibsass_import* golibsass_compiler_get_imports(struct Sass_Compiler* compiler, size_t* size);
+// int golibsass_compiler_failed_parsing(struct Sass_Compiler* compiler);
+//
+// struct golibsass_frame {
+//   char* name;
+//   char* path;
+//   size_t line;
+//   size_t column;
+//   int type;
+// };
+// struct golibsass_frame* golibsass_compiler_get_backtrace(struct Sass_Compiler* compiler, size_t* size);
 import "C"
 
 import (
+	"sync"
 	"unsafe"
+
+	"github.com/bep/golibsass/libsass/sassvalue"
 )
 
 // A bridge function to C to resolve imports.
 //
 //export BridgeImport
-func BridgeImport(currPath, prevPath *C.char, ci C.int) C.Sass_Import_List {
-	parent := C.GoString(prevPath)
+func BridgeImport(currPath *C.char, compiler *C.struct_Sass_Compiler, ci C.int) C.Sass_Import_List {
+	size := int(C.sass_compiler_get_import_stack_size(compiler))
+	stack := make([]Import, 0, size)
+	for i := 0; i < size; i++ {
+		entry := C.sass_compiler_get_import_entry(compiler, C.size_t(i))
+		imp := Import{
+			ImpPath: C.GoString(C.sass_import_get_imp_path(entry)),
+			AbsPath: C.GoString(C.sass_import_get_abs_path(entry)),
+		}
+		// LibSass pushes the entry of a data context twice.
+		if i == 1 && imp.ImpPath == stack[0].ImpPath {
+			continue
+		}
+		stack = append(stack, imp)
+	}
 	rel := C.GoString(currPath)
 	clist := C.sass_make_import_list(1)
 	golist := unsafe.Slice((*C.Sass_Import_Entry)(unsafe.Pointer(clist)), 1)
 
 	resolver, ok := importsStore.Get(int(ci)).(ImportResolver)
 	if ok {
-		npath, body, ok := resolver(rel, parent)
+		npath, body, ok, err := resolver(rel, stack)
+		if err != nil {
+			entry := C.sass_make_import_entry(currPath, nil, nil)
+			cmsg := C.CString(err.Error())
+			defer C.free(unsafe.Pointer(cmsg))
+			// No line and column info, report the error at the @import.
+			golist[0] = (C.Sass_Import_Entry)(C.sass_import_set_error(entry, cmsg, 0, 0))
+			return clist
+		}
 		if ok {
 			var bodyv *C.char // nil signals loading from the path.
 			if body != "" {
@@ -43,11 +88,175 @@ func BridgeImport(currPath, prevPath *C.char, ci C.int) C.Sass_Import_List {
 	return clist
 }
 
+// A bridge function to C to add headers.
+//
+//export BridgeHeaders
+func BridgeHeaders(ci C.uintptr_t) C.Sass_Import_List {
+	headers, _ := headersStore.Get(int(ci)).([]Header)
+	if len(headers) == 0 {
+		return nil
+	}
+
+	clist := C.sass_make_import_list(C.size_t(len(headers)))
+	golist := unsafe.Slice((*C.Sass_Import_Entry)(unsafe.Pointer(clist)), len(headers))
+	for i, header := range headers {
+		var bodyv *C.char // nil signals loading from the path.
+		if header.Body != "" {
+			bodyv = C.CString(header.Body)
+		}
+		cpath := C.CString(header.Path)
+		golist[i] = C.sass_make_import_entry(cpath, bodyv, nil)
+		C.free(unsafe.Pointer(cpath))
+	}
+	return clist
+}
+
+// A bridge function to C to call custom Sass functions.
+//
+//export BridgeFunction
+func BridgeFunction(args *C.union_Sass_Value, ci C.uintptr_t, compiler *C.struct_Sass_Compiler) *C.union_Sass_Value {
+	fn, ok := functionsStore.Get(int(ci)).(Function)
+	if !ok {
+		return makeError("function not found")
+	}
+
+	n := int(C.sass_list_get_length(args))
+	goargs := make([]sassvalue.Value, n)
+	for i := range n {
+		v, err := toGoValue(C.sass_list_get_value(args, C.size_t(i)))
+		if err != nil {
+			return makeError(err.Error())
+		}
+		goargs[i] = v
+	}
+
+	var callee Callee
+	if C.sass_compiler_get_callee_stack_size(compiler) > 0 {
+		entry := C.sass_compiler_get_last_callee(compiler)
+		callee = Callee{
+			Name:   C.GoString(C.sass_callee_get_name(entry)),
+			Path:   C.GoString(C.sass_callee_get_path(entry)),
+			Line:   int(C.sass_callee_get_line(entry)),
+			Column: int(C.sass_callee_get_column(entry)),
+		}
+	}
+
+	result, err := fn(callee, goargs)
+	if err != nil {
+		return makeError(err.Error())
+	}
+
+	v, err := toCValue(result)
+	if err != nil {
+		return makeError(err.Error())
+	}
+
+	return v
+}
+
+func makeError(msg string) *C.union_Sass_Value {
+	cmsg := C.CString(msg)
+	defer C.free(unsafe.Pointer(cmsg))
+	return C.sass_make_error(cmsg)
+}
+
 // SassCompilerExecute function as declared in sass/context.h:48
 func SassCompilerExecute(compiler SassCompiler) {
 	C.sass_compiler_execute(compiler)
 }
 
+// SassCompilerGetIncludedFiles returns the files included in the compilation
+// in import order, see a__included_files.cpp.
+func SassCompilerGetIncludedFiles(compiler SassCompiler) []string {
+	var size C.size_t
+	cfiles := C.golibsass_compiler_get_included_files(compiler, &size)
+	defer C.free(unsafe.Pointer(cfiles))
+
+	files := make([]string, size)
+	for i, f := range unsafe.Slice(cfiles, size) {
+		files[i] = C.GoString(f)
+		C.free(unsafe.Pointer(f))
+	}
+	return files
+}
+
+// ImportSite is the location of an @import statement.
+type ImportSite struct {
+	// The imported file.
+	Path string
+
+	// The importing file and the position of the @import statement in it.
+	Parent string
+	Line   int
+	Column int
+}
+
+// SassCompilerGetImports returns the @import statements in the compilation,
+// see a__imports.cpp.
+func SassCompilerGetImports(compiler SassCompiler) []ImportSite {
+	var size C.size_t
+	cimports := C.golibsass_compiler_get_imports(compiler, &size)
+	defer C.free(unsafe.Pointer(cimports))
+
+	imports := make([]ImportSite, size)
+	for i, imp := range unsafe.Slice(cimports, size) {
+		imports[i] = ImportSite{
+			Path:   C.GoString(imp.path),
+			Parent: C.GoString(imp.parent),
+			Line:   int(imp.line),
+			Column: int(imp.column),
+		}
+		C.free(unsafe.Pointer(imp.path))
+		C.free(unsafe.Pointer(imp.parent))
+	}
+	return imports
+}
+
+// CalleeType is the type of a Frame, see Sass_Callee_Type.
+type CalleeType int
+
+const (
+	CalleeMixin CalleeType = iota
+	CalleeFunction
+	CalleeCFunction
+)
+
+// Frame is a mixin or function call, the callee is the call site.
+type Frame struct {
+	Callee
+	Type CalleeType
+}
+
+// SassCompilerGetBacktrace returns the calls leading to the error of a failed
+// compilation, the innermost first, see a__backtrace.cpp.
+func SassCompilerGetBacktrace(compiler SassCompiler) []Frame {
+	var size C.size_t
+	cframes := C.golibsass_compiler_get_backtrace(compiler, &size)
+	defer C.free(unsafe.Pointer(cframes))
+
+	frames := make([]Frame, size)
+	for i, f := range unsafe.Slice(cframes, size) {
+		frames[i] = Frame{
+			Callee: Callee{
+				Name:   C.GoString(f.name),
+				Path:   C.GoString(f.path),
+				Line:   int(f.line),
+				Column: int(f.column),
+			},
+			Type: CalleeType(f._type),
+		}
+		C.free(unsafe.Pointer(f.name))
+		C.free(unsafe.Pointer(f.path))
+	}
+	return frames
+}
+
+// SassCompilerFailedParsing reports whether the compilation failed while
+// parsing a file, see a__imports.cpp.
+func SassCompilerFailedParsing(compiler SassCompiler) bool {
+	return C.golibsass_compiler_failed_parsing(compiler) != 0
+}
+
 // SassCompilerParse function as declared in sass/context.h:47
 func SassCompilerParse(compiler SassCompiler) {
 	C.sass_compiler_parse(compiler)
@@ -60,6 +269,12 @@ func SassContextGetErrorJSON(ctx SassContext) string {
 	return C.GoString(s)
 }
 
+// SassContextGetErrorSrc function as declared in sass/context.h:119
+func SassContextGetErrorSrc(ctx SassContext) string {
+	s := C.sass_context_get_error_src(ctx)
+	return C.GoString(s)
+}
+
 // SassContextGetErrorStatus function as declared in sass/context.h:114
 func SassContextGetErrorStatus(ctx SassContext) int {
 	return int(C.sass_context_get_error_status(ctx))
@@ -112,6 +327,21 @@ func SassDeleteOptions(options SassOptions) {
 	C.sass_delete_options(options)
 }
 
+// SassFileContextGetContext function as declared in sass/context.h:60
+func SassFileContextGetContext(ctx SassFileContext) SassContext {
+	return (SassContext)(C.sass_file_context_get_context(ctx))
+}
+
+// SassFileContextGetOptions function as declared in sass/context.h:65
+func SassFileContextGetOptions(ctx SassFileContext) SassOptions {
+	return (SassOptions)(C.sass_file_context_get_options(ctx))
+}
+
+// SassFileContextSetOptions function as declared in sass/context.h:67
+func SassFileContextSetOptions(ctx SassFileContext, opt SassOptions) {
+	C.sass_file_context_set_options(ctx, opt)
+}
+
 // SassMakeDataCompiler function as declared in sass/context.h:43
 func SassMakeDataCompiler(ctx SassDataContext) SassCompiler {
 	return (SassCompiler)(C.sass_make_data_compiler(ctx))
@@ -123,6 +353,18 @@ func SassMakeDataContext(s string) SassDataContext {
 	return (SassDataContext)(ctx)
 }
 
+// SassMakeFileCompiler function as declared in sass/context.h:42
+func SassMakeFileCompiler(ctx SassFileContext) SassCompiler {
+	return (SassCompiler)(C.sass_make_file_compiler(ctx))
+}
+
+// SassMakeFileContext function as declared in sass/context.h:34
+func SassMakeFileContext(filename string) SassFileContext {
+	s := C.CString(filename)
+	defer C.free(unsafe.Pointer(s))
+	return (SassFileContext)(C.sass_make_file_context(s))
+}
+
 // SassOptionGetSourceMapFile function as declared in sass/context.h:84
 func SassOptionGetSourceMapFile(opts SassOptions) string {
 	p := C.sass_option_get_source_map_file(opts)
@@ -158,6 +400,32 @@ func SassOptionSetOutputStyle(o SassOptions, i int) {
 	C.sass_option_set_output_style(o, uint32(i))
 }
 
+// LibSass keeps the pointers passed to sass_option_set_indent and
+// sass_option_set_linefeed without copying them, so we keep them around.
+var staticCStrings sync.Map
+
+func staticCString(s string) *C.char {
+	if v, found := staticCStrings.Load(s); found {
+		return v.(*C.char)
+	}
+	cs := C.CString(s)
+	v, loaded := staticCStrings.LoadOrStore(s, cs)
+	if loaded {
+		C.free(unsafe.Pointer(cs))
+	}
+	return v.(*C.char)
+}
+
+// SassOptionSetIndent function as declared in sass/context.h:99
+func SassOptionSetIndent(o SassOptions, s string) {
+	C.sass_option_set_indent(o, staticCString(s))
+}
+
+// SassOptionSetLinefeed function as declared in sass/context.h:100
+func SassOptionSetLinefeed(o SassOptions, s string) {
+	C.sass_option_set_linefeed(o, staticCString(s))
+}
+
 // SassOptionGetPrecision function as declared in sass/context.h:91
 func SassOptionSetPrecision(o SassOptions, i int) {
 	C.sass_option_set_precision(o, C.int(i))
@@ -0,0 +1,151 @@
+// Copyright © 2022 Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+package libsass
+
+// #include "stdlib.h"
+// #include "sass/values.h"
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/bep/golibsass/libsass/sassvalue"
+)
+
+// toGoValue converts a LibSass value into its Go representation.
+func toGoValue(v *C.union_Sass_Value) (sassvalue.Value, error) {
+	switch C.sass_value_get_tag(v) {
+	case C.SASS_NULL:
+		return sassvalue.Null{}, nil
+	case C.SASS_BOOLEAN:
+		return sassvalue.Bool(C.sass_boolean_get_value(v)), nil
+	case C.SASS_NUMBER:
+		return sassvalue.Number{
+			Value: float64(C.sass_number_get_value(v)),
+			Unit:  C.GoString(C.sass_number_get_unit(v)),
+		}, nil
+	case C.SASS_STRING:
+		return sassvalue.String{
+			Value:  C.GoString(C.sass_string_get_value(v)),
+			Quoted: bool(C.sass_string_is_quoted(v)),
+		}, nil
+	case C.SASS_COLOR:
+		return sassvalue.Color{
+			R: float64(C.sass_color_get_r(v)),
+			G: float64(C.sass_color_get_g(v)),
+			B: float64(C.sass_color_get_b(v)),
+			A: float64(C.sass_color_get_a(v)),
+		}, nil
+	case C.SASS_LIST:
+		list := sassvalue.List{
+			Items:     make([]sassvalue.Value, int(C.sass_list_get_length(v))),
+			Bracketed: bool(C.sass_list_get_is_bracketed(v)),
+		}
+		if C.sass_list_get_separator(v) == C.SASS_SPACE {
+			list.Separator = sassvalue.Space
+		}
+		for i := range list.Items {
+			item, err := toGoValue(C.sass_list_get_value(v, C.size_t(i)))
+			if err != nil {
+				return nil, err
+			}
+			list.Items[i] = item
+		}
+		return list, nil
+	case C.SASS_MAP:
+		m := sassvalue.Map{
+			Entries: make([]sassvalue.MapEntry, int(C.sass_map_get_length(v))),
+		}
+		for i := range m.Entries {
+			key, err := toGoValue(C.sass_map_get_key(v, C.size_t(i)))
+			if err != nil {
+				return nil, err
+			}
+			value, err := toGoValue(C.sass_map_get_value(v, C.size_t(i)))
+			if err != nil {
+				return nil, err
+			}
+			m.Entries[i] = sassvalue.MapEntry{Key: key, Value: value}
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unsupported Sass value type %d", C.sass_value_get_tag(v))
+	}
+}
+
+// toCValue converts v into a newly allocated LibSass value.
+// The caller (usually LibSass) takes ownership of the returned value.
+func toCValue(v sassvalue.Value) (*C.union_Sass_Value, error) {
+	switch vv := v.(type) {
+	case nil, sassvalue.Null:
+		return C.sass_make_null(), nil
+	case sassvalue.Bool:
+		return C.sass_make_boolean(C.bool(vv)), nil
+	case sassvalue.Number:
+		unit := C.CString(vv.Unit)
+		defer C.free(unsafe.Pointer(unit))
+		return C.sass_make_number(C.double(vv.Value), unit), nil
+	case sassvalue.String:
+		s := C.CString(vv.Value)
+		defer C.free(unsafe.Pointer(s))
+		if vv.Quoted {
+			// LibSass unquotes the value when converting it back to its AST,
+			// so we need to quote it to preserve the quotes.
+			q := C.sass_string_quote(s, '"')
+			defer C.sass_free_memory(unsafe.Pointer(q))
+			return C.sass_make_qstring(q), nil
+		}
+		return C.sass_make_string(s), nil
+	case sassvalue.Color:
+		return C.sass_make_color(C.double(vv.R), C.double(vv.G), C.double(vv.B), C.double(vv.A)), nil
+	case sassvalue.List:
+		var sep C.enum_Sass_Separator = C.SASS_COMMA
+		if vv.Separator == sassvalue.Space {
+			sep = C.SASS_SPACE
+		}
+		list := C.sass_make_list(C.size_t(len(vv.Items)), sep, C.bool(vv.Bracketed))
+		for i, item := range vv.Items {
+			citem, err := toCValue(item)
+			if err != nil {
+				C.sass_delete_value(list)
+				return nil, err
+			}
+			C.sass_list_set_value(list, C.size_t(i), citem)
+		}
+		return list, nil
+	case sassvalue.Map:
+		m := C.sass_make_map(C.size_t(len(vv.Entries)))
+		for i, entry := range vv.Entries {
+			key, err := toCValue(entry.Key)
+			if err != nil {
+				C.sass_delete_value(m)
+				return nil, err
+			}
+			C.sass_map_set_key(m, C.size_t(i), key)
+			value, err := toCValue(entry.Value)
+			if err != nil {
+				C.sass_delete_value(m)
+				return nil, err
+			}
+			C.sass_map_set_value(m, C.size_t(i), value)
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unsupported Sass value type %T", v)
+	}
+}
+
+// Stringify formats v the same way LibSass does in its output.
+func Stringify(v sassvalue.Value, precision int) (string, error) {
+	cv, err := toCValue(v)
+	if err != nil {
+		return "", err
+	}
+	defer C.sass_delete_value(cv)
+	s := C.sass_value_stringify(cv, false, C.int(precision))
+	defer C.sass_delete_value(s)
+	return C.GoString(C.sass_string_get_value(s)), nil
+}
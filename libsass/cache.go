@@ -0,0 +1,313 @@
+// Copyright © 2022 Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package libsass
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// CacheBackend stores cached compilation results.
+// Implementations must be safe for concurrent use.
+type CacheBackend interface {
+	// Get returns the value stored for key, or false if not found.
+	Get(key string) ([]byte, bool, error)
+
+	// Set stores value for key.
+	Set(key string, value []byte) error
+}
+
+// CacheOptions configures the cache, see NewCached.
+type CacheOptions struct {
+	// Backend stores the results.
+	// Default is an in-memory LRU cache with room for 1000 results.
+	Backend CacheBackend
+
+	// Key is added to the cache key.
+	// The Go funcs in Options (import resolvers, functions and the source map
+	// rewriter) and IncludeFS cannot be hashed, and imports resolved by them
+	// cannot be checked for changes, so change Key when their output may change.
+	Key string
+}
+
+// NewCached creates a new libsass transpiler configured with the given options
+// that caches the results in cacheOptions.Backend.
+//
+// Results are keyed by the source (or the filename for ExecuteFile) and the
+// options, and are invalidated when the content of any of the files they
+// included changes. Failed compilations are not cached.
+func NewCached(options Options, cacheOptions CacheOptions) (Transpiler, error) {
+	t, err := New(options)
+	if err != nil {
+		return nil, err
+	}
+	if cacheOptions.Backend == nil {
+		cacheOptions.Backend = NewMemoryCache(1000)
+	}
+	return &cachedTranspiler{
+		t:          t,
+		backend:    cacheOptions.Backend,
+		optionsKey: optionsKey(options, cacheOptions.Key),
+	}, nil
+}
+
+type cachedTranspiler struct {
+	t          Transpiler
+	backend    CacheBackend
+	optionsKey string
+}
+
+// Bump this when the cached format or the compiled output changes.
+const cacheVersion = "2"
+
+// cacheEntry is what's stored in the CacheBackend.
+type cacheEntry struct {
+	Result Result
+
+	// The files included in the compilation.
+	Dependencies []cacheDependency
+}
+
+type cacheDependency struct {
+	Filename string
+
+	// The hash of the content, empty if the file could not be read from
+	// the file system, e.g. if resolved by an ImportResolver.
+	Hash string
+}
+
+func (t *cachedTranspiler) Execute(src string) (Result, error) {
+	return t.ExecuteContext(context.Background(), src)
+}
+
+func (t *cachedTranspiler) ExecuteContext(ctx context.Context, src string) (Result, error) {
+	return t.execute("src", src, func() (Result, error) {
+		return t.t.ExecuteContext(ctx, src)
+	})
+}
+
+func (t *cachedTranspiler) ExecuteFile(filename string) (Result, error) {
+	return t.ExecuteFileContext(context.Background(), filename)
+}
+
+func (t *cachedTranspiler) ExecuteFileContext(ctx context.Context, filename string) (Result, error) {
+	// The content of the file itself is in the dependencies.
+	input := filename
+	if abs, err := filepath.Abs(filename); err == nil {
+		input = abs
+	}
+	return t.execute("file", input, func() (Result, error) {
+		return t.t.ExecuteFileContext(ctx, filename)
+	})
+}
+
+func (t *cachedTranspiler) execute(kind, input string, compile func() (Result, error)) (Result, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s", t.optionsKey, kind, input)
+	key := hex.EncodeToString(h.Sum(nil))
+
+	b, found, err := t.backend.Get(key)
+	if err != nil {
+		return Result{}, fmt.Errorf("cache: %w", err)
+	}
+	if found {
+		var entry cacheEntry
+		if err := json.Unmarshal(b, &entry); err == nil && entry.isValid() {
+			return entry.Result, nil
+		}
+	}
+
+	result, err := compile()
+	if err != nil {
+		return result, err
+	}
+
+	entry := cacheEntry{Result: result}
+	for _, filename := range result.IncludedFiles {
+		dep := cacheDependency{Filename: filename}
+		if !isIncludeFSPath(filename) {
+			dep.Hash, _ = hashFile(filename)
+		}
+		entry.Dependencies = append(entry.Dependencies, dep)
+	}
+	if b, err = json.Marshal(entry); err != nil {
+		return result, fmt.Errorf("cache: %w", err)
+	}
+	if err := t.backend.Set(key, b); err != nil {
+		return result, fmt.Errorf("cache: %w", err)
+	}
+
+	return result, nil
+}
+
+// isValid reports whether none of the dependencies have changed.
+func (e cacheEntry) isValid() bool {
+	for _, dep := range e.Dependencies {
+		if dep.Hash == "" {
+			continue
+		}
+		if hash, err := hashFile(dep.Filename); err != nil || hash != dep.Hash {
+			return false
+		}
+	}
+	return true
+}
+
+func hashFile(filename string) (string, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// optionsKey returns a key for the parts of options that can be hashed.
+func optionsKey(options Options, key string) string {
+	signatures := make([]string, 0, len(options.Functions))
+	for signature := range options.Functions {
+		signatures = append(signatures, signature)
+	}
+	sort.Strings(signatures)
+	resolvers := make([]string, len(options.ImportResolvers))
+	for i, r := range options.ImportResolvers {
+		resolvers[i] = fmt.Sprintf("%s:%v", r.Name, r.Priority)
+	}
+
+	h := sha256.New()
+	sourceMapOptions := options.SourceMapOptions
+	sourceMapOptions.SourceRewriter = nil
+	// %#v prints maps sorted by key.
+	fmt.Fprintf(h, "%q|%d|%d|%q|%q|%q|%#v|%#v|%t|%t|%t|%#v|%d|%t|%q|%q|%t|%q",
+		key,
+		options.OutputStyle,
+		options.Precision,
+		options.Indent,
+		options.Linefeed,
+		options.IncludePaths,
+		options.Variables,
+		options.Headers,
+		options.SassSyntax,
+		options.WarningsAsErrors,
+		options.SourceComments,
+		sourceMapOptions,
+		len(options.IncludeFS),
+		options.ImportResolver != nil,
+		resolvers,
+		signatures,
+		options.SourceMapOptions.SourceRewriter != nil,
+		cacheVersion,
+	)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// NewMemoryCache creates a new in-memory CacheBackend holding at most
+// maxEntries results, evicting the least recently used.
+func NewMemoryCache(maxEntries int) CacheBackend {
+	return &memoryCache{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+type memoryCache struct {
+	maxEntries int
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key   string
+	value []byte
+}
+
+func (c *memoryCache) Get(key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, found := c.items[key]
+	if !found {
+		return nil, false, nil
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*memoryCacheItem).value, true, nil
+}
+
+func (c *memoryCache) Set(key string, value []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, found := c.items[key]; found {
+		el.Value.(*memoryCacheItem).value = value
+		c.ll.MoveToFront(el)
+		return nil
+	}
+	c.items[key] = c.ll.PushFront(&memoryCacheItem{key: key, value: value})
+	for c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.items, el.Value.(*memoryCacheItem).key)
+	}
+	return nil
+}
+
+// NewDirCache creates a new CacheBackend storing the results as files in dir,
+// which is created if needed.
+// It can be shared between processes. Pruning old files is left to the caller.
+func NewDirCache(dir string) CacheBackend {
+	return dirCache{dir: dir}
+}
+
+type dirCache struct {
+	dir string
+}
+
+func (c dirCache) Get(key string) ([]byte, bool, error) {
+	b, err := os.ReadFile(c.filename(key))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+func (c dirCache) Set(key string, value []byte) error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	// Write to a temporary file first so readers never see a partial file.
+	f, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(value); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), c.filename(key))
+}
+
+func (c dirCache) filename(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
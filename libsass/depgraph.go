@@ -0,0 +1,153 @@
+// Copyright © 2022 Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package libsass
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/bep/golibsass/libsass/libsasserrors"
+)
+
+// DependencyGraph tracks the files each compiled entry depends on, e.g. to
+// find the entries to rebuild when a partial changes.
+// It is safe for concurrent use.
+type DependencyGraph struct {
+	mu sync.RWMutex
+
+	// Maps an entry to its dependencies, including itself.
+	dependencies map[string]map[string]bool
+
+	// Maps a dependency to the entries depending on it.
+	dependents map[string]map[string]bool
+}
+
+// NewDependencyGraph creates a new empty DependencyGraph.
+func NewDependencyGraph() *DependencyGraph {
+	return &DependencyGraph{
+		dependencies: make(map[string]map[string]bool),
+		dependents:   make(map[string]map[string]bool),
+	}
+}
+
+// Update records the dependencies of entry from the result of compiling it,
+// e.g.
+//
+//	result, err := transpiler.ExecuteFile(filename)
+//	graph.Update(filename, result, err)
+//
+// The dependencies are the files in Result.IncludedFiles, which includes
+// the paths returned by import resolvers, except those loaded from
+// Options.IncludeFS.
+// If err is not nil, the previous dependencies of entry are kept and the file
+// the error points to is added, so entry is affected when it gets fixed.
+func (g *DependencyGraph) Update(entry string, result Result, err error) {
+	entry = normalizeDependency(entry)
+	dependencies := map[string]bool{entry: true}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err != nil {
+		for dep := range g.dependencies[entry] {
+			dependencies[dep] = true
+		}
+		var lerr libsasserrors.Error
+		if errors.As(err, &lerr) && lerr.File != "" && lerr.File != "stdin" && !isIncludeFSPath(lerr.File) {
+			dependencies[normalizeDependency(lerr.File)] = true
+		}
+	} else {
+		for _, filename := range result.IncludedFiles {
+			if isIncludeFSPath(filename) {
+				// Not on disk.
+				continue
+			}
+			dependencies[normalizeDependency(filename)] = true
+		}
+	}
+
+	g.remove(entry)
+	g.dependencies[entry] = dependencies
+	for dep := range dependencies {
+		if g.dependents[dep] == nil {
+			g.dependents[dep] = make(map[string]bool)
+		}
+		g.dependents[dep][entry] = true
+	}
+}
+
+// Remove removes entry from the graph.
+func (g *DependencyGraph) Remove(entry string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.remove(normalizeDependency(entry))
+}
+
+func (g *DependencyGraph) remove(entry string) {
+	for dep := range g.dependencies[entry] {
+		delete(g.dependents[dep], entry)
+		if len(g.dependents[dep]) == 0 {
+			delete(g.dependents, dep)
+		}
+	}
+	delete(g.dependencies, entry)
+}
+
+// Entries returns the recorded entries, sorted.
+func (g *DependencyGraph) Entries() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	entries := make([]string, 0, len(g.dependencies))
+	for entry := range g.dependencies {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+// Dependencies returns the transitive dependencies of entry, including entry
+// itself, sorted. It returns nil if entry is not recorded.
+func (g *DependencyGraph) Dependencies(entry string) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return sortedKeys(g.dependencies[normalizeDependency(entry)])
+}
+
+// Affected returns the entries depending on any of the given paths, sorted.
+func (g *DependencyGraph) Affected(paths ...string) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	affected := make(map[string]bool)
+	for _, path := range paths {
+		for entry := range g.dependents[normalizeDependency(path)] {
+			affected[entry] = true
+		}
+	}
+	return sortedKeys(affected)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// normalizeDependency makes filename absolute so paths relative to the current
+// directory match the absolute paths reported by LibSass.
+func normalizeDependency(filename string) string {
+	if abs, err := filepath.Abs(filename); err == nil {
+		return abs
+	}
+	return filepath.Clean(filename)
+}
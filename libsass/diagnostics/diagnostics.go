@@ -0,0 +1,162 @@
+// Copyright © 2022 Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package diagnostics converts compile errors and warnings to machine-readable
+// formats for editors and CI, a JSON schema of our own and SARIF.
+package diagnostics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/bep/golibsass/libsass"
+	"github.com/bep/golibsass/libsass/libsasserrors"
+)
+
+// Version is the version of the JSON schema, bumped on incompatible changes.
+const Version = 1
+
+// Severity is the severity of a Diagnostic.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// Position is a 1-based line and column.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Range is the source range of a Diagnostic.
+// LibSass only reports where the problem starts, so End is currently always
+// equal to Start.
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Location is a range in a file.
+type Location struct {
+	File  string `json:"file"`
+	Range Range  `json:"range"`
+}
+
+// Diagnostic is an error or a message from @warn or @debug.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+
+	// The file and range the diagnostic applies to.
+	// File is empty and Range zero if not known.
+	File  string `json:"file,omitempty"`
+	Range Range  `json:"range"`
+
+	Message string `json:"message"`
+
+	// ImportChain holds the @import statements that led to File,
+	// the closest first.
+	ImportChain []Location `json:"import_chain,omitempty"`
+}
+
+// FromError creates a Diagnostic from an error returned by a Transpiler.
+func FromError(err error) Diagnostic {
+	var lerr libsasserrors.Error
+	if !errors.As(err, &lerr) {
+		return Diagnostic{Severity: SeverityError, Message: err.Error()}
+	}
+	d := Diagnostic{
+		Severity: SeverityError,
+		File:     lerr.File,
+		Range:    pointRange(lerr.Line, lerr.Column),
+		Message:  lerr.Message,
+	}
+	if lerr.Details != nil {
+		d.ImportChain = importChain(lerr.Details.ImportChain)
+	}
+	return d
+}
+
+// FromMessage creates a Diagnostic from a message in Result.Warnings.
+// Debug messages get SeverityInfo.
+func FromMessage(m libsass.Message) Diagnostic {
+	severity := SeverityWarning
+	if m.Kind == libsass.DebugMessage {
+		severity = SeverityInfo
+	}
+	return Diagnostic{
+		Severity:    severity,
+		File:        m.File,
+		Range:       pointRange(m.Line, m.Column),
+		Message:     m.Message,
+		ImportChain: importChain(m.ImportChain),
+	}
+}
+
+// Collect returns the diagnostics for the result and error of a compilation,
+// e.g.
+//
+//	result, err := transpiler.ExecuteFile(filename)
+//	diags := diagnostics.Collect(result, err)
+func Collect(result libsass.Result, err error) []Diagnostic {
+	var diags []Diagnostic
+	for _, m := range result.Warnings {
+		diags = append(diags, FromMessage(m))
+	}
+	if err != nil {
+		diags = append(diags, FromError(err))
+	}
+	return diags
+}
+
+func pointRange(line, column int) Range {
+	p := Position{Line: line, Column: column}
+	return Range{Start: p, End: p}
+}
+
+func importChain(sites []libsasserrors.ImportSite) []Location {
+	if len(sites) == 0 {
+		return nil
+	}
+	chain := make([]Location, len(sites))
+	for i, site := range sites {
+		chain[i] = Location{File: site.File, Range: pointRange(site.Line, site.Column)}
+	}
+	return chain
+}
+
+// Report is a list of diagnostics.
+type Report struct {
+	// Version is the version of the JSON schema.
+	Version     int          `json:"version"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// NewReport creates a new Report with the given diagnostics.
+func NewReport(diags ...Diagnostic) Report {
+	if diags == nil {
+		diags = []Diagnostic{}
+	}
+	return Report{Version: Version, Diagnostics: diags}
+}
+
+// JSON returns the report as JSON.
+func (r Report) JSON() ([]byte, error) {
+	return marshal(r)
+}
+
+func marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,80 @@
+// Copyright © 2022 Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package diagnostics
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bep/golibsass/libsass"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestDiagnostics(t *testing.T) {
+	c := qt.New(t)
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main.scss")
+	partial := filepath.Join(dir, "_a.scss")
+	c.Assert(os.WriteFile(main, []byte("@debug 42;\n@import \"a\";\n"), 0o644), qt.IsNil)
+	c.Assert(os.WriteFile(partial, []byte("@warn \"careful\";\na { b: $c; }\n"), 0o644), qt.IsNil)
+
+	transpiler, err := libsass.New(libsass.Options{})
+	c.Assert(err, qt.IsNil)
+	result, err := transpiler.ExecuteFile(main)
+	c.Assert(err, qt.Not(qt.IsNil))
+
+	chain := []Location{{File: main, Range: Range{Start: Position{2, 1}, End: Position{2, 1}}}}
+	diags := Collect(result, err)
+	c.Assert(diags, qt.DeepEquals, []Diagnostic{
+		{Severity: SeverityInfo, File: main, Range: Range{Start: Position{1, 8}, End: Position{1, 8}}, Message: "42"},
+		{Severity: SeverityWarning, File: partial, Range: Range{Start: Position{1, 7}, End: Position{1, 7}}, Message: "careful", ImportChain: chain},
+		{Severity: SeverityError, File: partial, Range: Range{Start: Position{2, 8}, End: Position{2, 8}}, Message: `Undefined variable: "$c".`, ImportChain: chain},
+	})
+
+	c.Run("JSON", func(c *qt.C) {
+		b, err := NewReport(diags...).JSON()
+		c.Assert(err, qt.IsNil)
+		var report Report
+		c.Assert(json.Unmarshal(b, &report), qt.IsNil)
+		c.Assert(report.Version, qt.Equals, Version)
+		c.Assert(report.Diagnostics, qt.DeepEquals, diags)
+		c.Assert(string(b), qt.Contains, `"import_chain": [`)
+
+		b, err = NewReport().JSON()
+		c.Assert(err, qt.IsNil)
+		c.Assert(string(b), qt.Equals, "{\n\t\"version\": 1,\n\t\"diagnostics\": []\n}")
+	})
+
+	c.Run("SARIF", func(c *qt.C) {
+		b, err := NewReport(diags[2], FromError(errors.New("boom"))).SARIF()
+		c.Assert(err, qt.IsNil)
+		var log sarifLog
+		c.Assert(json.Unmarshal(b, &log), qt.IsNil)
+		c.Assert(log.Version, qt.Equals, "2.1.0")
+		c.Assert(log.Runs, qt.HasLen, 1)
+		results := log.Runs[0].Results
+		c.Assert(results, qt.HasLen, 2)
+
+		c.Assert(results[0].Level, qt.Equals, "error")
+		c.Assert(results[0].Locations, qt.HasLen, 1)
+		loc := results[0].Locations[0].PhysicalLocation
+		c.Assert(loc.ArtifactLocation.URI, qt.Equals, "file://"+filepath.ToSlash(partial))
+		c.Assert(*loc.Region, qt.Equals, sarifRegion{StartLine: 2, StartColumn: 8, EndLine: 2, EndColumn: 8})
+		c.Assert(results[0].RelatedLocations, qt.HasLen, 1)
+		c.Assert(results[0].RelatedLocations[0].PhysicalLocation.ArtifactLocation.URI, qt.Equals, "file://"+filepath.ToSlash(main))
+
+		c.Assert(results[1].Message.Text, qt.Equals, "boom")
+		c.Assert(results[1].Locations, qt.IsNil)
+	})
+
+	c.Run("URI", func(c *qt.C) {
+		c.Assert(sarifURI("stdin"), qt.Equals, "stdin")
+		c.Assert(sarifURI(filepath.Join("a b", "c.scss")), qt.Equals, "a%20b/c.scss")
+	})
+}
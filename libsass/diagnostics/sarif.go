@@ -0,0 +1,149 @@
+// Copyright © 2022 Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package diagnostics
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// The subset of SARIF 2.1.0 we need, see
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+type (
+	sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+
+	sarifDriver struct {
+		Name           string `json:"name"`
+		InformationURI string `json:"informationUri"`
+	}
+
+	sarifResult struct {
+		Level            string          `json:"level"`
+		Message          sarifMessage    `json:"message"`
+		Locations        []sarifLocation `json:"locations,omitempty"`
+		RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+	}
+
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+
+	sarifLocation struct {
+		ID               *int                  `json:"id,omitempty"`
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+		Message          *sarifMessage         `json:"message,omitempty"`
+	}
+
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+		Region           *sarifRegion          `json:"region,omitempty"`
+	}
+
+	sarifArtifactLocation struct {
+		URI string `json:"uri"`
+	}
+
+	sarifRegion struct {
+		StartLine   int `json:"startLine"`
+		StartColumn int `json:"startColumn,omitempty"`
+		EndLine     int `json:"endLine,omitempty"`
+		EndColumn   int `json:"endColumn,omitempty"`
+	}
+)
+
+// SARIF returns the report as a SARIF 2.1.0 log with one run.
+// The import chain is reported as related locations.
+func (r Report) SARIF() ([]byte, error) {
+	results := make([]sarifResult, 0, len(r.Diagnostics))
+	for _, d := range r.Diagnostics {
+		result := sarifResult{
+			Level:   sarifLevel(d.Severity),
+			Message: sarifMessage{Text: d.Message},
+		}
+		if d.File != "" {
+			result.Locations = []sarifLocation{sarifLocationFor(d.File, d.Range)}
+		}
+		for i, loc := range d.ImportChain {
+			id := i + 1
+			related := sarifLocationFor(loc.File, loc.Range)
+			related.ID = &id
+			related.Message = &sarifMessage{Text: "Imported from here."}
+			result.RelatedLocations = append(result.RelatedLocations, related)
+		}
+		results = append(results, result)
+	}
+
+	return marshal(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{
+			{
+				Tool: sarifTool{
+					Driver: sarifDriver{
+						Name:           "golibsass",
+						InformationURI: "https://github.com/bep/golibsass",
+					},
+				},
+				Results: results,
+			},
+		},
+	})
+}
+
+func sarifLevel(s Severity) string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return "note"
+}
+
+func sarifLocationFor(file string, r Range) sarifLocation {
+	loc := sarifLocation{
+		PhysicalLocation: sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: sarifURI(file)},
+		},
+	}
+	if r.Start.Line > 0 {
+		loc.PhysicalLocation.Region = &sarifRegion{
+			StartLine:   r.Start.Line,
+			StartColumn: r.Start.Column,
+			EndLine:     r.End.Line,
+			EndColumn:   r.End.Column,
+		}
+	}
+	return loc
+}
+
+// sarifURI returns file as a file:// URI if absolute, else as a relative
+// reference.
+func sarifURI(file string) string {
+	path := filepath.ToSlash(file)
+	if !filepath.IsAbs(file) {
+		return (&url.URL{Path: path}).String()
+	}
+	if !strings.HasPrefix(path, "/") {
+		// Windows, e.g. C:/foo.
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
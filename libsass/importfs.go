@@ -0,0 +1,162 @@
+// Copyright © 2022 Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package libsass
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bep/golibsass/internal/libsass"
+)
+
+// The extensions LibSass tries, in order.
+var importExtensions = []string{".scss", ".sass", ".css"}
+
+// includeFSPrefix prefixes the paths of the files loaded from
+// Options.IncludeFS, followed by the index of the file system, e.g.
+// "includefs:0/_colors.scss", so they are not mistaken for files on disk.
+const includeFSPrefix = "includefs:"
+
+// isIncludeFSPath reports whether filename was loaded from Options.IncludeFS.
+func isIncludeFSPath(filename string) bool {
+	return strings.HasPrefix(filename, includeFSPrefix)
+}
+
+// fsResolver resolves imports from the file systems in Options.IncludeFS
+// using the same candidate search order as LibSass uses for IncludePaths.
+type fsResolver struct {
+	filesystems []fs.FS
+}
+
+func newFSResolver(filesystems []fs.FS) *fsResolver {
+	return &fsResolver{filesystems: filesystems}
+}
+
+func (r *fsResolver) Resolve(url, prev string) (string, string, bool, error) {
+	if idx, name, ok := r.split(prev); ok {
+		// Relative to the importing file.
+		filename, err := r.find(r.filesystems[idx], path.Dir(name), url)
+		if err != nil || filename != "" {
+			return r.load(idx, filename, err)
+		}
+	} else {
+		// LibSass looks in the directory of the importing file before it
+		// looks anywhere else, so let it resolve the import if it's there.
+		// For Execute, that's the working directory.
+		filename, err := r.find(os.DirFS(filepath.Dir(prev)), ".", url)
+		if err != nil || filename != "" {
+			return "", "", false, nil
+		}
+	}
+
+	for idx, fsys := range r.filesystems {
+		filename, err := r.find(fsys, ".", url)
+		if err != nil || filename != "" {
+			return r.load(idx, filename, err)
+		}
+	}
+
+	return "", "", false, nil
+}
+
+func (r *fsResolver) load(idx int, filename string, err error) (string, string, bool, error) {
+	if err != nil {
+		return "", "", false, err
+	}
+	b, err := fs.ReadFile(r.filesystems[idx], filename)
+	if err != nil {
+		return "", "", false, err
+	}
+	body := string(b)
+	if path.Ext(filename) == ".sass" {
+		body = libsass.SassToScss(body)
+	}
+	return fmt.Sprintf("%s%d/%s", includeFSPrefix, idx, filename), body, true, nil
+}
+
+// split splits a path returned by load into the index of the file system
+// and the name in it.
+func (r *fsResolver) split(filename string) (int, string, bool) {
+	if !isIncludeFSPath(filename) {
+		return 0, "", false
+	}
+	s, name, found := strings.Cut(strings.TrimPrefix(filename, includeFSPrefix), "/")
+	if !found {
+		return 0, "", false
+	}
+	idx, err := strconv.Atoi(s)
+	if err != nil || idx < 0 || idx >= len(r.filesystems) {
+		return 0, "", false
+	}
+	return idx, name, true
+}
+
+// find finds url in dir in fsys, returning an empty filename if not found.
+func (r *fsResolver) find(fsys fs.FS, dir, url string) (string, error) {
+	filename := path.Join(dir, url)
+	if !fs.ValidPath(filename) {
+		return "", nil
+	}
+	base, name := path.Split(filename)
+
+	exists := func(filename string) bool {
+		fi, err := fs.Stat(fsys, filename)
+		return err == nil && !fi.IsDir()
+	}
+
+	var candidates []string
+	try := func(names ...string) {
+		for _, name := range names {
+			if filename := path.Join(base, name); exists(filename) {
+				candidates = append(candidates, filename)
+			}
+		}
+	}
+
+	try(name, "_"+name)
+	for _, ext := range importExtensions {
+		try("_" + name + ext)
+	}
+	for _, ext := range importExtensions {
+		try(name + ext)
+	}
+
+	if len(candidates) == 0 {
+		for _, ext := range importExtensions {
+			if strings.HasSuffix(name, ext) {
+				// Ignore directories that look like importable files.
+				return "", nil
+			}
+		}
+		for _, ext := range importExtensions {
+			try(path.Join(name, "_index"+ext))
+		}
+		for _, ext := range importExtensions {
+			try(path.Join(name, "index"+ext))
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", nil
+	case 1:
+		return candidates[0], nil
+	default:
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "It's not clear which file to import for '@import \"%s\"'.\nCandidates:\n", url)
+		for _, candidate := range candidates {
+			fmt.Fprintf(&sb, "  %s\n", candidate)
+		}
+		sb.WriteString("Please delete or rename all but one of these files.\n")
+		return "", errors.New(sb.String())
+	}
+}
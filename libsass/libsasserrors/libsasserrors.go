@@ -8,9 +8,40 @@ package libsasserrors
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 )
 
+// The kinds of errors, use errors.Is to check the kind of an Error, e.g.
+//
+//	if errors.Is(err, libsasserrors.ErrUndefinedVariable) {
+//		// ...
+//	}
+var (
+	// ErrSyntax is a parse error, e.g. an unclosed block.
+	ErrSyntax = errors.New("syntax error")
+
+	ErrUndefinedVariable = errors.New("undefined variable")
+	ErrUndefinedMixin    = errors.New("undefined mixin")
+	ErrUndefinedFunction = errors.New("undefined function")
+
+	// ErrImportNotFound is an @import or an entry file that could not be found.
+	ErrImportNotFound = errors.New("import not found")
+
+	// ErrInvalidArgument is a wrong number of arguments or an argument of the
+	// wrong type or range.
+	ErrInvalidArgument = errors.New("invalid argument")
+
+	// ErrStackOverflow is too deep recursion in mixins or functions.
+	ErrStackOverflow = errors.New("stack overflow")
+
+	// ErrUser is an error raised with @error.
+	ErrUser = errors.New("user error")
+
+	// ErrInternal is an unexpected error in LibSass.
+	ErrInternal = errors.New("internal error")
+)
+
 // JsonToError converts a JSON string to an error.
 func JsonToError(jsonstr string) (e Error) {
 	_ = json.Unmarshal([]byte(jsonstr), &e)
@@ -18,14 +49,89 @@ func JsonToError(jsonstr string) (e Error) {
 }
 
 // Error is a libsass error.
+// It is comparable with == as long as Err is.
 type Error struct {
 	Status  int    `json:"status"`
 	Column  int    `json:"column"`
 	File    string `json:"file"`
 	Line    int    `json:"line"`
 	Message string `json:"message"`
+
+	// Formatted is the error as formatted by LibSass, with the backtrace
+	// and the offending source line marked with a caret.
+	Formatted string `json:"formatted,omitempty"`
+
+	// Details holds the context of the error, nil if not known.
+	// It's a pointer to keep Error comparable.
+	Details *Details `json:"details,omitempty"`
+
+	// Kind is one of the Err* kinds above, nil if not known.
+	Kind error `json:"-"`
+
+	// Err is the error returned from Go, e.g. by an import resolver or a
+	// custom function, that caused this error, if any.
+	Err error `json:"-"`
+}
+
+// Details is the context of an Error.
+type Details struct {
+	// Snippet holds the source lines around Error.Line, nil if not known.
+	Snippet []SourceLine `json:"snippet,omitempty"`
+
+	// Trace holds the mixin and function calls that led to the error,
+	// the innermost first.
+	Trace []Frame `json:"trace,omitempty"`
+
+	// ImportChain holds the @import statements that led to Error.File,
+	// the closest first.
+	ImportChain []ImportSite `json:"import_chain,omitempty"`
+}
+
+// Frame is a mixin or function call.
+type Frame struct {
+	Kind FrameKind `json:"kind"`
+	Name string    `json:"name"`
+
+	// The position of the call.
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// FrameKind is the kind of callable in a Frame.
+type FrameKind string
+
+const (
+	FrameMixin    FrameKind = "mixin"
+	FrameFunction FrameKind = "function"
+
+	// A function implemented in Go.
+	FrameCFunction FrameKind = "c-function"
+)
+
+// SourceLine is a line in a source file.
+type SourceLine struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// ImportSite is the location of an @import statement.
+type ImportSite struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
 }
 
 func (e Error) Error() string {
 	return fmt.Sprintf("file %q, line %d, col %d: %s ", e.File, e.Line, e.Column, e.Message)
 }
+
+// Is reports whether target is the Kind of e.
+func (e Error) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+// Unwrap returns Err.
+func (e Error) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,106 @@
+// Copyright © 2022 Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package libsasserrors
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[1;31m"
+	ansiBlue  = "\x1b[1;34m"
+)
+
+// Render renders e as a compiler diagnostic with the message, the location,
+// the source snippet with a caret under the column, the trace and the import
+// chain, e.g.
+//
+//	error: Undefined variable: "$c".
+//	 --> src/_a.scss:2:8
+//	  |
+//	1 | $a: 1;
+//	2 | a { b: $c; }
+//	  |        ^
+//	  = imported from src/main.scss:2:1
+//
+// If color is set, the output is colored with ANSI escape codes.
+func (e Error) Render(color bool) string {
+	style := func(code, s string) string {
+		if !color {
+			return s
+		}
+		return code + s + ansiReset
+	}
+
+	var details Details
+	if e.Details != nil {
+		details = *e.Details
+	}
+
+	var sb strings.Builder
+	sb.WriteString(style(ansiRed, "error") + style(ansiBold, ": "+e.Message) + "\n")
+
+	// The gutter is as wide as the largest line number.
+	width := 0
+	for _, l := range details.Snippet {
+		width = max(width, len(strconv.Itoa(l.Line)))
+	}
+	pad := strings.Repeat(" ", width)
+	gutter := func(s string) string {
+		return style(ansiBlue, s+" |")
+	}
+
+	if e.File != "" {
+		location := e.File
+		if e.Line > 0 {
+			location += fmt.Sprintf(":%d:%d", e.Line, e.Column)
+		}
+		fmt.Fprintf(&sb, "%s%s %s\n", pad, style(ansiBlue, "-->"), location)
+	}
+
+	if len(details.Snippet) > 0 {
+		sb.WriteString(gutter(pad) + "\n")
+		for _, l := range details.Snippet {
+			fmt.Fprintf(&sb, "%s %s\n", gutter(fmt.Sprintf("%*d", width, l.Line)), l.Text)
+			if l.Line == e.Line && e.Column > 0 {
+				fmt.Fprintf(&sb, "%s %s%s\n", gutter(pad), caretIndent(l.Text, e.Column), style(ansiRed, "^"))
+			}
+		}
+	}
+
+	for _, f := range details.Trace {
+		fmt.Fprintf(&sb, "%s %s in %s `%s`, called from %s:%d:%d\n", pad, style(ansiBlue, "="), f.Kind, f.Name, f.File, f.Line, f.Column)
+	}
+	for _, site := range details.ImportChain {
+		fmt.Fprintf(&sb, "%s %s imported from %s:%d:%d\n", pad, style(ansiBlue, "="), site.File, site.Line, site.Column)
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// caretIndent returns the indentation to put a caret under column, a
+// 1-based count of characters in line. Tabs are kept so the caret lines up.
+func caretIndent(line string, column int) string {
+	var sb strings.Builder
+	for _, r := range line {
+		if column <= 1 {
+			break
+		}
+		if unicode.IsSpace(r) {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteByte(' ')
+		}
+		column--
+	}
+	sb.WriteString(strings.Repeat(" ", max(column-1, 0)))
+	return sb.String()
+}
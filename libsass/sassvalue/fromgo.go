@@ -0,0 +1,196 @@
+// Copyright © 2022 Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package sassvalue
+
+import (
+	"fmt"
+	"image/color"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	numberRe = regexp.MustCompile(`^([+-]?(?:\d+(?:\.\d*)?|\.\d+)(?:[eE][+-]?\d+)?)([a-zA-Z]+|%)?$`)
+	hexRe    = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3,4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+)
+
+// FromGo converts v into a Sass value:
+//
+//   - nil becomes Null.
+//   - Values already of type Value are returned as is.
+//   - Booleans become Bool and Go numbers become unitless Numbers.
+//   - Strings are read as simple Sass values: numbers with an optional unit,
+//     e.g. "16px", become Numbers, hex colors and color keywords, e.g.
+//     "#ff0000" and "red", become Colors, and strings in quotes become quoted
+//     Strings. Strings with commas or whitespace outside of quotes and
+//     parentheses, e.g. "Helvetica, Arial" and "1px solid #000", become comma
+//     and space separated Lists of such values. Other strings, including
+//     function calls like "rgba(0, 0, 0, .5)", become unquoted Strings; use a
+//     String to pass a string as is.
+//   - A color.Color becomes a Color.
+//   - Slices and arrays become comma separated Lists.
+//   - Maps become Maps with the entries sorted by key.
+func FromGo(v any) (Value, error) {
+	switch vv := v.(type) {
+	case nil:
+		return Null{}, nil
+	case Value:
+		return vv, nil
+	case string:
+		return fromString(vv), nil
+	case color.Color:
+		c := color.NRGBAModel.Convert(vv).(color.NRGBA)
+		return Color{R: float64(c.R), G: float64(c.G), B: float64(c.B), A: float64(c.A) / 255}, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return Bool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Number{Value: float64(rv.Int())}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return Number{Value: float64(rv.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return Number{Value: rv.Float()}, nil
+	case reflect.String:
+		return fromString(rv.String()), nil
+	case reflect.Slice, reflect.Array:
+		list := List{Items: make([]Value, rv.Len())}
+		for i := range list.Items {
+			item, err := FromGo(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			list.Items[i] = item
+		}
+		return list, nil
+	case reflect.Map:
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		m := Map{Entries: make([]MapEntry, len(keys))}
+		for i, key := range keys {
+			k, err := FromGo(key.Interface())
+			if err != nil {
+				return nil, err
+			}
+			value, err := FromGo(rv.MapIndex(key).Interface())
+			if err != nil {
+				return nil, err
+			}
+			m.Entries[i] = MapEntry{Key: k, Value: value}
+		}
+		return m, nil
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return Null{}, nil
+		}
+		return FromGo(rv.Elem().Interface())
+	}
+
+	return nil, fmt.Errorf("unsupported Go type %T", v)
+}
+
+func fromString(s string) Value {
+	for _, sep := range []Separator{Comma, Space} {
+		if items := splitList(s, sep); len(items) > 1 {
+			list := List{Items: make([]Value, len(items)), Separator: sep}
+			for i, item := range items {
+				list.Items[i] = fromString(item)
+			}
+			return list
+		}
+	}
+
+	if m := numberRe.FindStringSubmatch(s); m != nil {
+		if f, err := strconv.ParseFloat(m[1], 64); err == nil {
+			return Number{Value: f, Unit: m[2]}
+		}
+	}
+	if hexRe.MatchString(s) {
+		return fromHex(s[1:])
+	}
+	if c, found := colorNames[strings.ToLower(s)]; found {
+		return c
+	}
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return String{Value: s[1 : len(s)-1], Quoted: true}
+	}
+	return String{Value: s}
+}
+
+// splitList splits s into the trimmed items of a list with the given
+// separator, ignoring separators in quotes and parentheses.
+func splitList(s string, sep Separator) []string {
+	isSep := func(r rune) bool {
+		if sep == Comma {
+			return r == ','
+		}
+		return unicode.IsSpace(r)
+	}
+
+	var (
+		items []string
+		depth int
+		quote rune
+		start int
+	)
+	add := func(item string) {
+		item = strings.TrimSpace(item)
+		if sep == Space && item == "" {
+			return
+		}
+		items = append(items, item)
+	}
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case depth == 0 && isSep(r):
+			add(s[start:i])
+			start = i + utf8.RuneLen(r)
+		}
+	}
+	add(s[start:])
+	return items
+}
+
+// fromHex parses a validated hex color without the leading #.
+func fromHex(s string) Color {
+	if len(s) <= 4 {
+		// Expand the short form, e.g. "f00" to "ff0000".
+		var sb strings.Builder
+		for _, r := range s {
+			sb.WriteRune(r)
+			sb.WriteRune(r)
+		}
+		s = sb.String()
+	}
+	channel := func(i int) float64 {
+		n, _ := strconv.ParseUint(s[i*2:i*2+2], 16, 8)
+		return float64(n)
+	}
+	c := Color{R: channel(0), G: channel(1), B: channel(2), A: 1}
+	if len(s) == 8 {
+		c.A = channel(3) / 255
+	}
+	return c
+}
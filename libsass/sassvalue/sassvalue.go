@@ -0,0 +1,74 @@
+// Copyright © 2022 Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package sassvalue holds the Go representations of Sass values passed
+// to and from LibSass.
+package sassvalue
+
+// Value is a Sass value.
+type Value interface {
+	sassValue()
+}
+
+// Null is the Sass null value.
+type Null struct{}
+
+// Bool is a Sass boolean.
+type Bool bool
+
+// Number is a Sass number with an optional unit, e.g. "px" or "%".
+type Number struct {
+	Value float64
+	Unit  string
+}
+
+// String is a Sass string.
+type String struct {
+	Value  string
+	Quoted bool
+}
+
+// Color is a Sass color with red, green and blue channels in the range 0-255
+// and alpha in the range 0-1.
+type Color struct {
+	R, G, B float64
+	A       float64
+}
+
+// Separator is the separator used between items in a Sass list.
+type Separator int
+
+const (
+	// Comma separated, e.g. "a, b, c".
+	Comma Separator = iota
+	// Space separated, e.g. "a b c".
+	Space
+)
+
+// List is a Sass list.
+type List struct {
+	Items     []Value
+	Separator Separator
+	Bracketed bool
+}
+
+// Map is a Sass map. The order of the entries is preserved.
+type Map struct {
+	Entries []MapEntry
+}
+
+// MapEntry is a key/value pair in a Sass map.
+type MapEntry struct {
+	Key   Value
+	Value Value
+}
+
+func (Null) sassValue()   {}
+func (Bool) sassValue()   {}
+func (Number) sassValue() {}
+func (String) sassValue() {}
+func (Color) sassValue()  {}
+func (List) sassValue()   {}
+func (Map) sassValue()    {}
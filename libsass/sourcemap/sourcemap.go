@@ -0,0 +1,155 @@
+// Copyright © 2022 Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package sourcemap holds a typed representation of the version 3 source maps
+// generated by LibSass.
+package sourcemap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SourceMap is a version 3 source map.
+type SourceMap struct {
+	Version        int      `json:"version"`
+	File           string   `json:"file,omitempty"`
+	SourceRoot     string   `json:"sourceRoot,omitempty"`
+	Sources        []string `json:"sources"`
+	SourcesContent []string `json:"sourcesContent,omitempty"`
+	Names          []string `json:"names"`
+
+	// The Base64 VLQ encoded mappings, see DecodeMappings.
+	Mappings string `json:"mappings"`
+}
+
+// Mapping maps a position in the generated file to a position in a source.
+// All lines and columns are zero-based.
+type Mapping struct {
+	GeneratedLine   int
+	GeneratedColumn int
+
+	// The index into Sources, -1 if this position has no source.
+	Source       int
+	SourceLine   int
+	SourceColumn int
+
+	// The index into Names, -1 if none.
+	Name int
+}
+
+// Parse parses the JSON source map in data.
+func Parse(data []byte) (*SourceMap, error) {
+	var m SourceMap
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse source map: %w", err)
+	}
+	return &m, nil
+}
+
+// JSON returns m as JSON, formatted the same way as LibSass does.
+func (m *SourceMap) JSON() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	// Keep e.g. "a > b" in SourcesContent readable.
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(m); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// DecodeMappings decodes the mappings in m.
+func (m *SourceMap) DecodeMappings() ([]Mapping, error) {
+	var mappings []Mapping
+
+	// All fields but the generated column are relative to the previous
+	// segment in the file, the generated column to the previous segment on
+	// the same line.
+	var source, sourceLine, sourceColumn, name int
+
+	for line, segments := range strings.Split(m.Mappings, ";") {
+		var column int
+		for _, segment := range strings.Split(segments, ",") {
+			if segment == "" {
+				continue
+			}
+			fields, err := decodeVLQ(segment)
+			if err != nil {
+				return nil, err
+			}
+
+			column += fields[0]
+			mapping := Mapping{
+				GeneratedLine:   line,
+				GeneratedColumn: column,
+				Source:          -1,
+				Name:            -1,
+			}
+
+			switch len(fields) {
+			case 1:
+			case 4, 5:
+				source += fields[1]
+				sourceLine += fields[2]
+				sourceColumn += fields[3]
+				mapping.Source = source
+				mapping.SourceLine = sourceLine
+				mapping.SourceColumn = sourceColumn
+				if len(fields) == 5 {
+					name += fields[4]
+					mapping.Name = name
+				}
+			default:
+				return nil, fmt.Errorf("invalid mapping segment %q", segment)
+			}
+
+			if mapping.Source >= len(m.Sources) || mapping.Name >= len(m.Names) {
+				return nil, fmt.Errorf("mapping segment %q out of range", segment)
+			}
+
+			mappings = append(mappings, mapping)
+		}
+	}
+
+	return mappings, nil
+}
+
+const base64Chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// decodeVLQ decodes the Base64 VLQ values in segment.
+func decodeVLQ(segment string) ([]int, error) {
+	var (
+		values []int
+		value  int
+		shift  uint
+	)
+	for i := 0; i < len(segment); i++ {
+		digit := strings.IndexByte(base64Chars, segment[i])
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid character %q in mapping segment %q", segment[i], segment)
+		}
+		value += (digit & 31) << shift
+		if digit&32 != 0 {
+			// Continuation bit.
+			shift += 5
+			continue
+		}
+		// The least significant bit is the sign.
+		if value&1 != 0 {
+			values = append(values, -(value >> 1))
+		} else {
+			values = append(values, value>>1)
+		}
+		value, shift = 0, 0
+	}
+	if shift != 0 {
+		return nil, fmt.Errorf("truncated mapping segment %q", segment)
+	}
+	return values, nil
+}
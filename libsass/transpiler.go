@@ -7,26 +7,168 @@
 package libsass
 
 import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/bep/golibsass/internal/libsass"
 	"github.com/bep/golibsass/libsass/libsasserrors"
+	"github.com/bep/golibsass/libsass/sassvalue"
+	"github.com/bep/golibsass/libsass/sourcemap"
 )
 
 type libsassTranspiler struct {
 	options Options
+
+	// All import resolvers sorted by priority.
+	importResolvers []ImportResolverEntry
+
+	// Options.Variables converted to Sass values, keyed by name without the "$".
+	variables map[string]sassvalue.Value
 }
 
+// The virtual path of the header defining Options.Variables.
+const variablesHeaderPath = "golibsass-variables"
+
+// The function used to look up Options.Variables from the variables header.
+const variableFuncName = "golibsass-variable"
+
+var variableNameRe = regexp.MustCompile(`^-?[a-zA-Z_][a-zA-Z0-9_-]*$`)
+
 // New creates a new libsass transpiler configured with the given options.
 func New(options Options) (Transpiler, error) {
-	return libsassTranspiler{options: options}, nil
+	importResolvers := make([]ImportResolverEntry, 0, len(options.ImportResolvers)+1)
+	for _, r := range options.ImportResolvers {
+		if r.Resolve == nil {
+			return nil, fmt.Errorf("import resolver %q: Resolve is nil", r.Name)
+		}
+		importResolvers = append(importResolvers, r)
+	}
+	if options.ImportResolver != nil {
+		resolver := options.ImportResolver
+		importResolvers = append(importResolvers, ImportResolverEntry{
+			Name: "ImportResolver",
+			Resolve: func(imp Import) (string, string, bool, error) {
+				newURL, body, resolved := resolver(imp.URL, imp.Prev)
+				return newURL, body, resolved, nil
+			},
+		})
+	}
+	sort.SliceStable(importResolvers, func(i, j int) bool {
+		return importResolvers[i].Priority > importResolvers[j].Priority
+	})
+
+	if strings.Trim(options.Indent, " \t") != "" {
+		return nil, fmt.Errorf("invalid Indent %q: only spaces and tabs are allowed", options.Indent)
+	}
+	switch options.Linefeed {
+	case "", "\n", "\r\n", "\r":
+	default:
+		return nil, fmt.Errorf("invalid Linefeed %q: must be one of \"\\n\", \"\\r\\n\" or \"\\r\"", options.Linefeed)
+	}
+
+	for i, h := range options.Headers {
+		if h.Path == "" {
+			return nil, fmt.Errorf("header %d: Path is required", i)
+		}
+	}
+
+	var variables map[string]sassvalue.Value
+	if len(options.Variables) > 0 {
+		variables = make(map[string]sassvalue.Value, len(options.Variables))
+		for name, v := range options.Variables {
+			name = strings.TrimPrefix(name, "$")
+			if !variableNameRe.MatchString(name) {
+				return nil, fmt.Errorf("invalid variable name %q", name)
+			}
+			if _, found := variables[name]; found {
+				return nil, fmt.Errorf("duplicate variable %q", name)
+			}
+			value, err := sassvalue.FromGo(v)
+			if err != nil {
+				return nil, fmt.Errorf("variable %q: %w", name, err)
+			}
+			variables[name] = value
+		}
+	}
+
+	return libsassTranspiler{options: options, importResolvers: importResolvers, variables: variables}, nil
 }
 
 // Execute transpiles the SCSS or SASS from src into dst.
 func (t libsassTranspiler) Execute(src string) (Result, error) {
-	var result Result
+	return t.ExecuteContext(context.Background(), src)
+}
+
+// ExecuteContext is like Execute, but returns ctx.Err() as soon as ctx is
+// cancelled or its deadline is exceeded.
+//
+// Note that LibSass cannot be interrupted, so the compilation may keep running
+// in the background until it reaches the next custom function or import
+// resolver call, where it is aborted.
+func (t libsassTranspiler) ExecuteContext(ctx context.Context, src string) (Result, error) {
+	return t.withContext(ctx, func() (Result, error) {
+		return t.execute(ctx, src)
+	})
+}
+
+// ExecuteFile transpiles the SCSS or SASS file in filename.
+// Unlike Execute, errors and source maps will refer to filename and not "stdin",
+// and relative imports are resolved from the directory of filename.
+// Files with the .sass extension are treated as "old style" SASS.
+func (t libsassTranspiler) ExecuteFile(filename string) (Result, error) {
+	return t.ExecuteFileContext(context.Background(), filename)
+}
 
+// ExecuteFileContext is like ExecuteFile, but with the cancellation
+// semantics of ExecuteContext.
+func (t libsassTranspiler) ExecuteFileContext(ctx context.Context, filename string) (Result, error) {
+	return t.withContext(ctx, func() (Result, error) {
+		return t.executeFile(ctx, filename)
+	})
+}
+
+// withContext runs execute and acts as a watchdog, returning as soon as ctx is done.
+func (t libsassTranspiler) withContext(ctx context.Context, execute func() (Result, error)) (Result, error) {
+	if ctx.Done() == nil {
+		// Can never be cancelled.
+		return execute()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	type resultErr struct {
+		result Result
+		err    error
+	}
+
+	done := make(chan resultErr, 1)
+	go func() {
+		result, err := execute()
+		done <- resultErr{result, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil && ctx.Err() != nil {
+			// Aborted in one of the callbacks.
+			return Result{}, ctx.Err()
+		}
+		return r.result, r.err
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	}
+}
+
+func (t libsassTranspiler) execute(ctx context.Context, src string) (Result, error) {
 	if t.options.SassSyntax {
 		// LibSass does not support this directly, so have to handle the main SASS content
 		// special.
@@ -35,77 +177,600 @@ func (t libsassTranspiler) Execute(src string) (Result, error) {
 
 	dataCtx := libsass.SassMakeDataContext(src)
 
+	state := &compileState{ctx: ctx}
+
 	opts := libsass.SassDataContextGetOptions(dataCtx)
-	{
-		// Set options
+	cleanup := t.setOptions(opts, state)
+	defer cleanup()
+	libsass.SassDataContextSetOptions(dataCtx, opts)
+
+	sctx := libsass.SassDataContextGetContext(dataCtx)
+	compiler := libsass.SassMakeDataCompiler(dataCtx)
+	defer libsass.SassDeleteCompiler(compiler)
+
+	return t.compile(sctx, compiler, opts, state)
+}
+
+func (t libsassTranspiler) executeFile(ctx context.Context, filename string) (Result, error) {
+	fileCtx := libsass.SassMakeFileContext(filename)
+
+	state := &compileState{ctx: ctx}
+
+	opts := libsass.SassFileContextGetOptions(fileCtx)
+	cleanup := t.setOptions(opts, state)
+	defer cleanup()
+	libsass.SassFileContextSetOptions(fileCtx, opts)
+
+	sctx := libsass.SassFileContextGetContext(fileCtx)
+	compiler := libsass.SassMakeFileCompiler(fileCtx)
+	defer libsass.SassDeleteCompiler(compiler)
+
+	return t.compile(sctx, compiler, opts, state)
+}
+
+// compileState holds the state of a single compilation.
+type compileState struct {
+	// Aborts the compilation in the next callback when done.
+	ctx context.Context
+
+	// Messages from @warn and @debug.
+	messages []Message
+
+	// The first error returned from a Go callback, which aborts the
+	// compilation.
+	err error
 
-		if t.options.ImportResolver != nil {
-			idx := libsass.AddImportResolver(opts, t.options.ImportResolver)
-			defer libsass.DeleteImportResolver(idx)
+	// Whether the compilation was aborted by an @error rule.
+	userError bool
+}
+
+// callbackError records err, if not nil, as the cause of the compile error.
+func (s *compileState) callbackError(err error) error {
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	return err
+}
+
+// setOptions applies t.options to opts.
+// The returned cleanup func must be called when the compilation is done.
+func (t libsassTranspiler) setOptions(opts libsass.SassOptions, state *compileState) (cleanup func()) {
+	var cleanups []func()
+	cleanup = func() {
+		for _, c := range cleanups {
+			c()
 		}
+	}
 
-		if t.options.Precision != 0 {
-			libsass.SassOptionSetPrecision(opts, t.options.Precision)
+	if len(t.importResolvers) > 0 || len(t.options.IncludeFS) > 0 {
+		var fsResolver *fsResolver
+		if len(t.options.IncludeFS) > 0 {
+			fsResolver = newFSResolver(t.options.IncludeFS)
 		}
+		idx := libsass.AddImportResolver(opts, func(url string, stack []libsass.Import) (string, string, bool, error) {
+			if err := state.ctx.Err(); err != nil {
+				return "", "", false, err
+			}
+			imp := Import{
+				URL:   url,
+				Stack: make([]ImportStackEntry, len(stack)),
+			}
+			for i, entry := range stack {
+				imp.Stack[i] = ImportStackEntry(entry)
+			}
+			prev := imp.Stack[len(imp.Stack)-1]
+			imp.Prev = prev.ImpPath
+
+			for _, r := range t.importResolvers {
+				newURL, body, resolved, err := r.Resolve(imp)
+				if err != nil || resolved {
+					return newURL, body, resolved, state.callbackError(err)
+				}
+			}
+			if fsResolver != nil {
+				// This needs the resolved path of the importing file to
+				// resolve relative imports.
+				newURL, body, resolved, err := fsResolver.Resolve(url, prev.AbsPath)
+				return newURL, body, resolved, state.callbackError(err)
+			}
+			// Let LibSass resolve the import.
+			return "", "", false, nil
+		})
+		cleanups = append(cleanups, func() { libsass.DeleteImportResolver(idx) })
+	}
 
-		if t.options.SourceMapOptions.Filename != "" {
-			libsass.SassOptionSetSourceMapFile(opts, t.options.SourceMapOptions.Filename)
+	funcs := make(map[string]libsass.Function, len(t.options.Functions)+3)
+	for signature, fn := range t.options.Functions {
+		funcs[signature] = func(callee libsass.Callee, args []sassvalue.Value) (sassvalue.Value, error) {
+			if err := state.ctx.Err(); err != nil {
+				return nil, err
+			}
+			v, err := fn(args)
+			return v, state.callbackError(err)
+		}
+	}
+	var headers []libsass.Header
+	if len(t.variables) > 0 {
+		// Define the variables in a header, which LibSass imports before
+		// the entry's source without shifting any of its positions.
+		// The values are looked up from Go to preserve their types.
+		names := make([]string, 0, len(t.variables))
+		for name := range t.variables {
+			names = append(names, name)
 		}
+		sort.Strings(names)
+		var sb strings.Builder
+		for _, name := range names {
+			fmt.Fprintf(&sb, "$%s: %s(%q);\n", name, variableFuncName, name)
+		}
+		headers = append(headers, libsass.Header{Path: variablesHeaderPath, Body: sb.String()})
 
-		if t.options.SourceMapOptions.Root != "" {
-			libsass.SassOptionSetSourceMapRoot(opts, t.options.SourceMapOptions.Root)
+		funcs[variableFuncName+"($name)"] = func(callee libsass.Callee, args []sassvalue.Value) (sassvalue.Value, error) {
+			name, _ := args[0].(sassvalue.String)
+			return t.variables[name.Value], nil
 		}
+	}
+
+	for _, h := range t.options.Headers {
+		headers = append(headers, libsass.Header(h))
+	}
+	if len(headers) > 0 {
+		idh := libsass.AddHeaders(opts, headers)
+		cleanups = append(cleanups, func() { libsass.DeleteHeaders(idh) })
+	}
+
+	// Capture @warn and @debug, which LibSass would otherwise write to stderr.
+	funcs["@warn($message)"] = t.messageFunc(WarningMessage, state)
+	funcs["@debug($message)"] = t.messageFunc(DebugMessage, state)
+	// Tell the errors from @error from other errors with the same message.
+	funcs["@error($message)"] = t.errorFunc(state)
+	ids := libsass.AddFunctions(opts, funcs)
+	cleanups = append(cleanups, func() { libsass.DeleteFunctions(ids) })
 
-		if t.options.SourceMapOptions.OutputPath != "" {
-			libsass.SassOptionSetOutputPath(opts, t.options.SourceMapOptions.OutputPath)
+	if t.options.Precision != 0 {
+		libsass.SassOptionSetPrecision(opts, t.options.Precision)
+	}
+
+	if t.options.Indent != "" {
+		libsass.SassOptionSetIndent(opts, t.options.Indent)
+	}
+	if t.options.Linefeed != "" {
+		libsass.SassOptionSetLinefeed(opts, t.options.Linefeed)
+	}
+
+	if t.options.SourceMapOptions.Filename != "" {
+		libsass.SassOptionSetSourceMapFile(opts, t.options.SourceMapOptions.Filename)
+	}
+
+	if t.options.SourceMapOptions.Root != "" {
+		libsass.SassOptionSetSourceMapRoot(opts, t.options.SourceMapOptions.Root)
+	}
+
+	if t.options.SourceMapOptions.OutputPath != "" {
+		libsass.SassOptionSetOutputPath(opts, t.options.SourceMapOptions.OutputPath)
+	}
+	if t.options.SourceMapOptions.InputPath != "" {
+		libsass.SassOptionSetInputPath(opts, t.options.SourceMapOptions.InputPath)
+	}
+
+	libsass.SassOptionSetSourceMapContents(opts, t.options.SourceMapOptions.Contents)
+	libsass.SassOptionSetOmitSourceMapURL(opts, t.options.SourceMapOptions.OmitURL)
+	libsass.SassOptionSetSourceMapEmbed(opts, t.options.SourceMapOptions.EnableEmbedded)
+	libsass.SassOptionSetIncludePath(opts, strings.Join(t.options.IncludePaths, string(os.PathListSeparator)))
+	libsass.SassOptionSetOutputStyle(opts, int(t.options.OutputStyle))
+	libsass.SassOptionSetSourceComments(opts, t.options.SourceComments)
+
+	return
+}
+
+func (t libsassTranspiler) messageFunc(kind MessageKind, state *compileState) libsass.Function {
+	return func(callee libsass.Callee, args []sassvalue.Value) (sassvalue.Value, error) {
+		if err := state.ctx.Err(); err != nil {
+			return nil, err
+		}
+		msg, err := t.messageString(args[0])
+		if err != nil {
+			return nil, err
+		}
+		state.messages = append(state.messages, Message{
+			Kind:    kind,
+			File:    callee.Path,
+			Line:    callee.Line,
+			Column:  callee.Column,
+			Message: msg,
+		})
+		return sassvalue.Null{}, nil
+	}
+}
+
+// errorFunc returns the message of an @error rule, which LibSass then fails
+// the compilation with, and records it as a user error.
+func (t libsassTranspiler) errorFunc(state *compileState) libsass.Function {
+	return func(callee libsass.Callee, args []sassvalue.Value) (sassvalue.Value, error) {
+		if err := state.ctx.Err(); err != nil {
+			return nil, err
 		}
-		if t.options.SourceMapOptions.InputPath != "" {
-			libsass.SassOptionSetInputPath(opts, t.options.SourceMapOptions.InputPath)
+		msg, err := t.messageString(args[0])
+		if err != nil {
+			return nil, err
 		}
+		state.userError = true
+		return sassvalue.String{Value: msg}, nil
+	}
+}
 
-		libsass.SassOptionSetSourceMapContents(opts, t.options.SourceMapOptions.Contents)
-		libsass.SassOptionSetOmitSourceMapURL(opts, t.options.SourceMapOptions.OmitURL)
-		libsass.SassOptionSetSourceMapEmbed(opts, t.options.SourceMapOptions.EnableEmbedded)
-		libsass.SassOptionSetIncludePath(opts, strings.Join(t.options.IncludePaths, string(os.PathListSeparator)))
-		libsass.SassOptionSetOutputStyle(opts, int(t.options.OutputStyle))
-		libsass.SassOptionSetSourceComments(opts, false)
-		libsass.SassDataContextSetOptions(dataCtx, opts)
+// messageString returns the message of an @warn, @debug or @error rule.
+func (t libsassTranspiler) messageString(v sassvalue.Value) (string, error) {
+	if s, ok := v.(sassvalue.String); ok {
+		return s.Value, nil
+	}
+	precision := t.options.Precision
+	if precision == 0 {
+		precision = defaultPrecision
 	}
+	return libsass.Stringify(v, precision)
+}
 
-	ctx := libsass.SassDataContextGetContext(dataCtx)
-	compiler := libsass.SassMakeDataCompiler(dataCtx)
-	defer libsass.SassDeleteCompiler(compiler)
+func (t libsassTranspiler) compile(ctx libsass.SassContext, compiler libsass.SassCompiler, opts libsass.SassOptions, state *compileState) (Result, error) {
+	var result Result
 
 	libsass.SassCompilerParse(compiler)
 	libsass.SassCompilerExecute(compiler)
 
+	imports := importChains(libsass.SassCompilerGetImports(compiler))
+	for i, m := range state.messages {
+		state.messages[i].ImportChain = imports(m.File)
+	}
+	result.Warnings = state.messages
+
 	if status := libsass.SassContextGetErrorStatus(ctx); status != 0 {
-		return result, libsasserrors.JsonToError(libsass.SassContextGetErrorJSON(ctx))
+		src := libsass.SassContextGetErrorSrc(ctx)
+		err := libsasserrors.JsonToError(libsass.SassContextGetErrorJSON(ctx))
+		err.Details = &libsasserrors.Details{
+			Snippet:     snippet(src, err.Line),
+			Trace:       trace(libsass.SassCompilerGetBacktrace(compiler)),
+			ImportChain: imports(err.File),
+		}
+		err.Err = state.err
+		switch {
+		case state.userError:
+			err.Kind = libsasserrors.ErrUser
+		case err.Err == nil:
+			err.Kind = errorKind(err, libsass.SassCompilerFailedParsing(compiler))
+		}
+		return result, err
+	}
+
+	if t.options.WarningsAsErrors {
+		for _, m := range state.messages {
+			if m.Kind == WarningMessage {
+				return result, libsasserrors.Error{
+					Status:  1,
+					File:    m.File,
+					Line:    m.Line,
+					Column:  m.Column,
+					Message: "Warning: " + m.Message,
+					Details: &libsasserrors.Details{ImportChain: m.ImportChain},
+				}
+			}
+		}
 	}
 
 	result.CSS = libsass.SassContextGetOutputString(ctx)
 	result.SourceMapFilename = libsass.SassOptionGetSourceMapFile(opts)
 	result.SourceMapContent = libsass.SassContextGetSourceMapString(ctx)
+	cwd, _ := os.Getwd()
+	if t.options.SourceComments {
+		// The paths in the source comments are relative to the current directory.
+		if rewriter := t.sourceRewriter(cwd); rewriter != nil {
+			result.CSS = rewriteSourceComments(result.CSS, rewriter)
+		}
+	}
+	// The sources in the source map are relative to the source map file.
+	sourceMapDir := cwd
+	if t.options.SourceMapOptions.Filename != "" {
+		if filename, err := filepath.Abs(t.options.SourceMapOptions.Filename); err == nil {
+			sourceMapDir = filepath.Dir(filename)
+		}
+	}
+	if rewriter := t.sourceRewriter(sourceMapDir); rewriter != nil {
+		if err := rewriteSources(&result, t.options.SourceMapOptions.EnableEmbedded, rewriter); err != nil {
+			return result, err
+		}
+	}
+	if result.SourceMapContent != "" {
+		sm, err := sourcemap.Parse([]byte(result.SourceMapContent))
+		if err != nil {
+			return result, err
+		}
+		result.SourceMap = sm
+	}
+	for _, filename := range libsass.SassCompilerGetIncludedFiles(compiler) {
+		if !t.isVirtualHeader(filename) {
+			result.IncludedFiles = append(result.IncludedFiles, filename)
+		}
+	}
 
 	return result, nil
 }
 
+// isVirtualHeader reports whether filename is the path of a header with its
+// source in memory, which is not a file on disk.
+func (t libsassTranspiler) isVirtualHeader(filename string) bool {
+	if len(t.options.Variables) > 0 && filename == variablesHeaderPath {
+		return true
+	}
+	for _, h := range t.options.Headers {
+		if h.Body != "" && filename == h.Path {
+			return true
+		}
+	}
+	return false
+}
+
+// importChains returns a func that returns the import chain of a file,
+// following the first import of each file.
+func importChains(sites []libsass.ImportSite) func(filename string) []libsasserrors.ImportSite {
+	parents := make(map[string]libsass.ImportSite, len(sites))
+	for _, site := range sites {
+		if _, found := parents[site.Path]; !found {
+			parents[site.Path] = site
+		}
+	}
+	return func(filename string) []libsasserrors.ImportSite {
+		var chain []libsasserrors.ImportSite
+		seen := map[string]bool{filename: true}
+		for {
+			site, found := parents[filename]
+			if !found || seen[site.Parent] {
+				return chain
+			}
+			chain = append(chain, libsasserrors.ImportSite{
+				File:   site.Parent,
+				Line:   site.Line,
+				Column: site.Column,
+			})
+			filename = site.Parent
+			seen[filename] = true
+		}
+	}
+}
+
+// trace converts the LibSass backtrace to Details.Trace.
+func trace(frames []libsass.Frame) []libsasserrors.Frame {
+	if len(frames) == 0 {
+		return nil
+	}
+	kinds := map[libsass.CalleeType]libsasserrors.FrameKind{
+		libsass.CalleeMixin:     libsasserrors.FrameMixin,
+		libsass.CalleeFunction:  libsasserrors.FrameFunction,
+		libsass.CalleeCFunction: libsasserrors.FrameCFunction,
+	}
+	trace := make([]libsasserrors.Frame, len(frames))
+	for i, f := range frames {
+		trace[i] = libsasserrors.Frame{
+			Kind:   kinds[f.Type],
+			Name:   f.Name,
+			File:   f.Path,
+			Line:   f.Line,
+			Column: f.Column,
+		}
+	}
+	return trace
+}
+
+// errorKind classifies err, which LibSass only reports with a message.
+// parsing is whether err happened while parsing.
+func errorKind(err libsasserrors.Error, parsing bool) error {
+	msg := err.Message
+	switch {
+	case strings.HasPrefix(msg, "File to import not found"), strings.HasPrefix(msg, "File to read not found"):
+		return libsasserrors.ErrImportNotFound
+	case err.Status != 1:
+		return libsasserrors.ErrInternal
+	case parsing:
+		return libsasserrors.ErrSyntax
+	case strings.HasPrefix(msg, "Undefined variable:"):
+		return libsasserrors.ErrUndefinedVariable
+	case strings.HasPrefix(msg, "no mixin named "):
+		return libsasserrors.ErrUndefinedMixin
+	case strings.HasPrefix(msg, "Function not found:"):
+		return libsasserrors.ErrUndefinedFunction
+	case strings.HasPrefix(msg, "Stack depth exceeded"), msg == "stack level too deep":
+		return libsasserrors.ErrStackOverflow
+	case strings.HasPrefix(msg, "argument `"),
+		strings.Contains(msg, "wrong number of arguments"),
+		strings.Contains(msg, "is missing argument"),
+		strings.Contains(msg, "has no parameter named"),
+		strings.Contains(msg, "doesn't support keyword arguments"),
+		strings.HasPrefix(msg, "index out of bounds"):
+		return libsasserrors.ErrInvalidArgument
+	}
+	return nil
+}
+
+// The number of lines before and after the error line in Details.Snippet.
+const snippetContext = 2
+
+// snippet returns the lines around line in src.
+func snippet(src string, line int) []libsasserrors.SourceLine {
+	if src == "" || line < 1 {
+		return nil
+	}
+	lines := strings.Split(src, "\n")
+	if line > len(lines) {
+		return nil
+	}
+	start, end := max(line-snippetContext, 1), min(line+snippetContext, len(lines))
+	// Skip the empty line after a trailing newline.
+	if end == len(lines) && end > line && lines[end-1] == "" {
+		end--
+	}
+	sl := make([]libsasserrors.SourceLine, 0, end-start+1)
+	for i := start; i <= end; i++ {
+		sl = append(sl, libsasserrors.SourceLine{Line: i, Text: strings.TrimSuffix(lines[i-1], "\r")})
+	}
+	return sl
+}
+
+const embeddedSourceMapPrefix = "/*# sourceMappingURL=data:application/json;base64,"
+
+// sourceRewriter returns the func to apply to the sources in the source map
+// and in source comments, which are relative to base, nil if none.
+func (t libsassTranspiler) sourceRewriter(base string) func(string) string {
+	opts := t.options.SourceMapOptions
+	if !opts.FileURLs {
+		return opts.SourceRewriter
+	}
+
+	// LibSass' source_map_file_urls option resolves the sources, which are
+	// relative to the source map file, from the current directory, so
+	// we do this ourselves.
+	return func(source string) string {
+		if !filepath.IsAbs(source) {
+			source = filepath.Join(base, source)
+		}
+		source = filepath.ToSlash(source)
+		if !strings.HasPrefix(source, "/") {
+			// Windows, e.g. C:/foo.
+			source = "/" + source
+		}
+		source = "file://" + source
+		if opts.SourceRewriter != nil {
+			source = opts.SourceRewriter(source)
+		}
+		return source
+	}
+}
+
+// Matches the source comments, e.g. "/* line 12, _buttons.scss */".
+var sourceCommentRe = regexp.MustCompile(`(/\* line \d+, )(.+?)( \*/)`)
+
+// rewriteSourceComments applies rewriter to the file names in the source
+// comments in css.
+func rewriteSourceComments(css string, rewriter func(string) string) string {
+	return sourceCommentRe.ReplaceAllStringFunc(css, func(comment string) string {
+		m := sourceCommentRe.FindStringSubmatch(comment)
+		return m[1] + rewriter(m[2]) + m[3]
+	})
+}
+
+// rewriteSources applies rewriter to the sources in SourceMapContent and,
+// if embedded, in the source map embedded in CSS.
+func rewriteSources(result *Result, embedded bool, rewriter func(string) string) error {
+	rewrite := func(data []byte) ([]byte, error) {
+		sm, err := sourcemap.Parse(data)
+		if err != nil {
+			return nil, err
+		}
+		for i, source := range sm.Sources {
+			sm.Sources[i] = rewriter(source)
+		}
+		return sm.JSON()
+	}
+
+	if result.SourceMapContent != "" {
+		data, err := rewrite([]byte(result.SourceMapContent))
+		if err != nil {
+			return err
+		}
+		result.SourceMapContent = string(data)
+	}
+
+	if !embedded {
+		return nil
+	}
+	start := strings.LastIndex(result.CSS, embeddedSourceMapPrefix)
+	if start == -1 {
+		return nil
+	}
+	start += len(embeddedSourceMapPrefix)
+	end := strings.Index(result.CSS[start:], " */")
+	if end == -1 {
+		return nil
+	}
+	end += start
+	// LibSass wraps the Base64 in lines.
+	encoded := strings.ReplaceAll(result.CSS[start:end], "\n", "")
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("failed to decode embedded source map: %w", err)
+	}
+	data, err = rewrite(data)
+	if err != nil {
+		return err
+	}
+	result.CSS = result.CSS[:start] + base64.StdEncoding.EncodeToString(data) + result.CSS[end:]
+
+	return nil
+}
+
 type Result struct {
 	CSS string
 
+	// Warnings holds the messages from @warn and @debug in the order they
+	// were emitted. It is also set when the compilation fails.
+	Warnings []Message
+
+	// IncludedFiles holds the files that took part in the compilation in import
+	// order, starting with the entry file for ExecuteFile.
+	// Headers with a Body and the Variables are not files and are left out.
+	// Imports handled by an ImportResolver are listed with the path it returned,
+	// files loaded from IncludeFS as "includefs:<index>/<path>", where index
+	// is the index of the file system in IncludeFS.
+	IncludedFiles []string
+
 	// If source maps are configured.
 	SourceMapFilename string
 	SourceMapContent  string
+
+	// SourceMap is SourceMapContent parsed, nil if no source map was generated.
+	SourceMap *sourcemap.SourceMap
 }
 
 type Transpiler interface {
 	Execute(src string) (Result, error)
+	ExecuteContext(ctx context.Context, src string) (Result, error)
+	ExecuteFile(filename string) (Result, error)
+	ExecuteFileContext(ctx context.Context, filename string) (Result, error)
+}
+
+// Message is a message emitted by @warn or @debug.
+type Message struct {
+	Kind    MessageKind
+	File    string
+	Line    int
+	Column  int
+	Message string
+
+	// ImportChain holds the @import statements that led to File,
+	// the closest first.
+	ImportChain []libsasserrors.ImportSite
 }
 
 type (
 	OutputStyle int
+	MessageKind int
 )
 
+const (
+	WarningMessage MessageKind = iota
+	DebugMessage
+)
+
+func (k MessageKind) String() string {
+	switch k {
+	case WarningMessage:
+		return "warning"
+	case DebugMessage:
+		return "debug"
+	}
+	return "unknown"
+}
+
+// The default precision of floating point math in LibSass.
+const defaultPrecision = 10
+
 const (
 	NestedStyle OutputStyle = iota
 	ExpandedStyle
@@ -136,19 +801,126 @@ type Options struct {
 	// Precision of floating point math.
 	Precision int
 
+	// Indent is the string used to indent the output, spaces and tabs only.
+	// Default is two spaces. Not used by CompressedStyle.
+	Indent string
+
+	// Linefeed is the line ending used in the output, one of "\n" (default),
+	// "\r\n" or "\r".
+	Linefeed string
+
 	// File paths to use to resolve imports.
 	IncludePaths []string
 
+	// IncludeFS are file systems, e.g. an embed.FS, used to resolve imports
+	// using the same rules as LibSass uses for IncludePaths (partials,
+	// extensions and index files).
+	// An import is first looked for relative to the importing file, on disk
+	// (in the working directory for Execute) or in the file system it was
+	// loaded from, then in each file system in order.
+	// They are consulted after any ImportResolvers, but before IncludePaths.
+	IncludeFS []fs.FS
+
 	// ImportResolver can be used to supply a custom import resolver, both to redirect
 	// to another URL or to return the body.
+	// This is the same as adding an entry with priority 0 to ImportResolvers.
 	ImportResolver func(url string, prev string) (newURL string, body string, resolved bool)
 
+	// ImportResolvers are tried in order of descending priority (resolvers with
+	// the same priority in slice order) until one resolves the import.
+	// If none does, LibSass will look for the import in the file system and IncludePaths.
+	ImportResolvers []ImportResolverEntry
+
+	// Variables are global Sass variables, keyed by name with or without
+	// the "$", defined before the entry's source is evaluated.
+	// The values are converted with sassvalue.FromGo, e.g. "16px" becomes a
+	// number, "red" a color and "1px solid #000" a list.
+	// Unlike prepending the declarations to the source, this does not shift
+	// the line numbers in errors and source maps. Values used as is map to
+	// the virtual "golibsass-variables" file in source maps.
+	Variables map[string]any
+
+	// Headers are imported before the entry's source, e.g. to make shared
+	// variables and mixins available to every stylesheet.
+	// They are imported after Variables, so they can use them.
+	Headers []Header
+
+	// Functions are custom Sass functions implemented in Go, keyed by their
+	// Sass signature, e.g. "asset-url($path, $fallback: null)".
+	// Any error returned will be reported as a Sass error at the call site.
+	Functions map[string]func(args []sassvalue.Value) (sassvalue.Value, error)
+
 	// Used to indicate "old style" SASS for the input stream.
 	SassSyntax bool
 
+	// SourceComments adds comments with the line number and file name, e.g.
+	// "/* line 12, _buttons.scss */", before each rule in the output.
+	// The file names are rewritten with SourceMapOptions.FileURLs and
+	// SourceMapOptions.SourceRewriter, if set.
+	SourceComments bool
+
+	// WarningsAsErrors makes Execute return an error for the first @warn
+	// encountered, useful for strict CI builds.
+	WarningsAsErrors bool
+
 	SourceMapOptions SourceMapOptions
 }
 
+// Header is a stylesheet imported before the entry's source,
+// see Options.Headers.
+type Header struct {
+	// The path of the header.
+	// If Body is set, this is a virtual path used in error messages and
+	// source maps and to resolve relative imports in Body.
+	// If not, the header is loaded from this path the same way as an @import
+	// in the entry file, using IncludePaths.
+	Path string
+
+	// The source of the header.
+	Body string
+}
+
+// ImportResolverEntry is a named import resolver with a priority,
+// see Options.ImportResolvers.
+type ImportResolverEntry struct {
+	// The name of this resolver, e.g. "theme-overrides".
+	Name string
+
+	// Resolvers with a higher priority are tried first.
+	Priority float64
+
+	// Resolve resolves imp, either by redirecting it to newURL
+	// or by returning its body.
+	// Return resolved=false to fall through to the next resolver.
+	// A non-nil error, e.g. "this import is forbidden", fails the compilation
+	// with a libsasserrors.Error pointing at the @import.
+	Resolve func(imp Import) (newURL string, body string, resolved bool, err error)
+}
+
+// Import is an @import to resolve.
+type Import struct {
+	// The URL as written in the @import.
+	URL string
+
+	// The path of the importing file as it was imported, same as the
+	// ImpPath of the last entry in Stack.
+	Prev string
+
+	// The chain of imports that led to this import, starting with the entry
+	// file ("stdin" for Execute) and ending with the importing file.
+	Stack []ImportStackEntry
+}
+
+// ImportStackEntry is an entry in the import stack.
+type ImportStackEntry struct {
+	// The path as written in the @import.
+	ImpPath string
+
+	// The resolved path, e.g. the path returned from an import resolver
+	// or the absolute file name.
+	AbsPath string
+}
+
 type SourceMapOptions struct {
 	Filename       string
 	Root           string
@@ -157,4 +929,19 @@ type SourceMapOptions struct {
 	Contents       bool
 	OmitURL        bool
 	EnableEmbedded bool
+
+	// FileURLs makes the sources absolute file:// URLs instead of paths
+	// relative to Filename, e.g. for editors and browser devtools to map
+	// back to local files.
+	// SourceRewriter, if set, receives these URLs.
+	FileURLs bool
+
+	// SourceRewriter, if set, is applied to every entry in the source map's
+	// sources, both in SourceMapContent and in the embedded source map,
+	// e.g. to replace local paths with public URLs.
+	// Note that LibSass makes the sources relative to Filename, or to the
+	// current directory if not set, before they are passed to SourceRewriter.
+	// It is also applied to the file names in Options.SourceComments, which
+	// are relative to the current directory.
+	SourceRewriter func(source string) string
 }
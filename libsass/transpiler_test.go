@@ -6,13 +6,23 @@
 package libsass
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"image/color"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/bep/golibsass/libsass/libsasserrors"
+	"github.com/bep/golibsass/libsass/sassvalue"
+	"github.com/bep/golibsass/libsass/sourcemap"
 	qt "github.com/frankban/quicktest"
 )
 
@@ -88,6 +98,366 @@ func TestError(t *testing.T) {
 	c.Assert(lerr.Column, qt.Equals, 14)
 	c.Assert(lerr.Message, qt.Equals, `Undefined variable: "$blue".`)
 	c.Assert(lerr.Error(), qt.Equals, `file "stdin", line 3, col 14: Undefined variable: "$blue". `)
+	c.Assert(lerr.Formatted, qt.Contains, ">> div { color: $blue; }\n   -------------^\n")
+	c.Assert(lerr.Details.Snippet, qt.DeepEquals, []libsasserrors.SourceLine{
+		{Line: 1, Text: ""},
+		{Line: 2, Text: ""},
+		{Line: 3, Text: "div { color: $blue; }"},
+	})
+
+	// Comparing errors must not panic.
+	c.Assert(err == error(lerr), qt.IsTrue)
+}
+
+func TestErrorRender(t *testing.T) {
+	c := qt.New(t)
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main.scss")
+	partial := filepath.Join(dir, "_a.scss")
+	c.Assert(os.WriteFile(main, []byte("@import \"a\";\n"), 0o644), qt.IsNil)
+	c.Assert(os.WriteFile(partial, []byte("$a: 1;\n\ta {\n\t\tb: $c;\n\t}\n\n\n"), 0o644), qt.IsNil)
+
+	transpiler, err := New(Options{})
+	c.Assert(err, qt.IsNil)
+	_, err = transpiler.ExecuteFile(main)
+	var lerr libsasserrors.Error
+	c.Assert(errors.As(err, &lerr), qt.IsTrue)
+	c.Assert(lerr.Details.Snippet, qt.HasLen, 5)
+
+	c.Assert(lerr.Render(false), qt.Equals, `error: Undefined variable: "$c".
+ --> `+partial+`:3:6
+  |
+1 | $a: 1;
+2 | 	a {
+3 | 		b: $c;
+  | 		   ^
+4 | 	}
+5 | 
+  = imported from `+main+`:1:1`)
+
+	colored := lerr.Render(true)
+	c.Assert(colored, qt.Contains, "\x1b[1;31m^\x1b[0m")
+	c.Assert(colored, qt.Contains, "\x1b[1;31merror\x1b[0m")
+}
+
+func TestErrorTrace(t *testing.T) {
+	c := qt.New(t)
+	dir := t.TempDir()
+	partial := filepath.Join(dir, "_a.scss")
+	c.Assert(os.WriteFile(partial, []byte("@function f($x) { @return $x + $undefined; }\n@mixin m($x) { width: f($x); }\n"), 0o644), qt.IsNil)
+
+	transpiler, err := New(Options{
+		IncludePaths: []string{dir},
+		Functions: map[string]func(args []sassvalue.Value) (sassvalue.Value, error){
+			"fail($v)": func(args []sassvalue.Value) (sassvalue.Value, error) {
+				return nil, errors.New("failed")
+			},
+		},
+	})
+	c.Assert(err, qt.IsNil)
+
+	_, err = transpiler.Execute("@import \"a\";\ndiv {\n  @include m(1px);\n}\n")
+	var lerr libsasserrors.Error
+	c.Assert(errors.As(err, &lerr), qt.IsTrue)
+	c.Assert(lerr.Details.Trace, qt.DeepEquals, []libsasserrors.Frame{
+		{Kind: libsasserrors.FrameFunction, Name: "f", File: partial, Line: 2, Column: 23},
+		{Kind: libsasserrors.FrameMixin, Name: "m", File: "stdin", Line: 3, Column: 12},
+	})
+	c.Assert(lerr.Render(false), qt.Contains, "= in function `f`, called from "+partial+":2:23\n  = in mixin `m`, called from stdin:3:12")
+
+	_, err = transpiler.Execute("@mixin n { a: fail(1); }\ndiv { @include n; }")
+	c.Assert(errors.As(err, &lerr), qt.IsTrue)
+	c.Assert(lerr.Details.Trace, qt.DeepEquals, []libsasserrors.Frame{
+		{Kind: libsasserrors.FrameCFunction, Name: "fail", File: "stdin", Line: 1, Column: 15},
+		{Kind: libsasserrors.FrameMixin, Name: "n", File: "stdin", Line: 2, Column: 16},
+	})
+
+	// No calls.
+	_, err = transpiler.Execute("div { a: $undefined; }")
+	c.Assert(errors.As(err, &lerr), qt.IsTrue)
+	c.Assert(lerr.Details.Trace, qt.IsNil)
+}
+
+func TestErrorKinds(t *testing.T) {
+	c := qt.New(t)
+	errBoom := errors.New("boom")
+	transpiler, err := New(Options{
+		Functions: map[string]func(args []sassvalue.Value) (sassvalue.Value, error){
+			"boom()": func(args []sassvalue.Value) (sassvalue.Value, error) {
+				return nil, fmt.Errorf("failed: %w", errBoom)
+			},
+		},
+	})
+	c.Assert(err, qt.IsNil)
+
+	for _, test := range []struct {
+		src  string
+		kind error
+	}{
+		{"a {", libsasserrors.ErrSyntax},
+		{"@if true { @import \"a\"; }", libsasserrors.ErrSyntax},
+		{"a { b: $c; }", libsasserrors.ErrUndefinedVariable},
+		{"a { @include m; }", libsasserrors.ErrUndefinedMixin},
+		{"a { b: get-function(f); }", libsasserrors.ErrUndefinedFunction},
+		{`@import "nope";`, libsasserrors.ErrImportNotFound},
+		{"a { b: percentage(red); }", libsasserrors.ErrInvalidArgument},
+		{"a { b: map-get((a: 1), b, c); }", libsasserrors.ErrInvalidArgument},
+		{"a { b: nth(1 2); }", libsasserrors.ErrInvalidArgument},
+		{"@function f() { @return f(); } a { b: f(); }", libsasserrors.ErrStackOverflow},
+		{"@mixin m { @include m; } a { @include m; }", libsasserrors.ErrStackOverflow},
+		{"a {\n  @error \"Not \" +\n    \"supported; use $x\";\n}", libsasserrors.ErrUser},
+		{`@error "Invalid value; got #{1}";`, libsasserrors.ErrUser},
+		{`a { b: c; } @error "oops: #{red}";`, libsasserrors.ErrUser},
+		{`@function f($x) { @error "bad #{$x}"; } a { b: f(1); }`, libsasserrors.ErrUser},
+		{`@while true { @error "stop"; }`, libsasserrors.ErrUser},
+		{"a { b: 1px + 1em; }", nil},
+	} {
+		_, err := transpiler.Execute(test.src)
+		c.Assert(err, qt.Not(qt.IsNil), qt.Commentf(test.src))
+		var lerr libsasserrors.Error
+		c.Assert(errors.As(err, &lerr), qt.IsTrue)
+		c.Assert(lerr.Kind, qt.Equals, test.kind, qt.Commentf("%s: %s", test.src, lerr.Message))
+		if test.kind != nil {
+			c.Assert(errors.Is(err, test.kind), qt.IsTrue)
+		}
+		c.Assert(errors.Is(err, libsasserrors.ErrInternal), qt.IsFalse)
+	}
+
+	dir := t.TempDir()
+	_, err = transpiler.ExecuteFile(filepath.Join(dir, "nope.scss"))
+	c.Assert(errors.Is(err, libsasserrors.ErrImportNotFound), qt.IsTrue)
+
+	filename := filepath.Join(dir, "main.scss")
+	c.Assert(os.WriteFile(filepath.Join(dir, "_a.scss"), []byte("a { b: $c; }"), 0o644), qt.IsNil)
+	c.Assert(os.WriteFile(filename, []byte(`@import "a";`), 0o644), qt.IsNil)
+	_, err = transpiler.ExecuteFile(filename)
+	c.Assert(errors.Is(err, libsasserrors.ErrUndefinedVariable), qt.IsTrue)
+	c.Assert(os.WriteFile(filepath.Join(dir, "_a.scss"), []byte("a { b: c"), 0o644), qt.IsNil)
+	_, err = transpiler.ExecuteFile(filename)
+	c.Assert(errors.Is(err, libsasserrors.ErrSyntax), qt.IsTrue)
+
+	// Errors from Go are wrapped.
+	_, err = transpiler.Execute("a { b: boom(); }")
+	c.Assert(err, qt.ErrorMatches, ".*error in C function boom: failed: boom.*")
+	c.Assert(errors.Is(err, errBoom), qt.IsTrue)
+	var lerr libsasserrors.Error
+	c.Assert(errors.As(err, &lerr), qt.IsTrue)
+	c.Assert(lerr.Kind, qt.IsNil)
+
+	// The next compilation starts over.
+	_, err = transpiler.Execute("a { b: $c; }")
+	c.Assert(errors.Is(err, errBoom), qt.IsFalse)
+}
+
+func TestFunctions(t *testing.T) {
+	c := qt.New(t)
+
+	transpiler, err := New(Options{
+		OutputStyle: CompressedStyle,
+		Functions: map[string]func(args []sassvalue.Value) (sassvalue.Value, error){
+			"asset-url($path, $fallback: null)": func(args []sassvalue.Value) (sassvalue.Value, error) {
+				path := args[0].(sassvalue.String)
+				if path.Value == "" {
+					return args[1], nil
+				}
+				return sassvalue.String{Value: fmt.Sprintf("url(/assets/%s)", path.Value)}, nil
+			},
+			"double($n)": func(args []sassvalue.Value) (sassvalue.Value, error) {
+				n, ok := args[0].(sassvalue.Number)
+				if !ok {
+					return nil, errors.New("expected a number")
+				}
+				return sassvalue.Number{Value: n.Value * 2, Unit: n.Unit}, nil
+			},
+			"is-dark($theme)": func(args []sassvalue.Value) (sassvalue.Value, error) {
+				return sassvalue.Bool(args[0].(sassvalue.String).Value == "dark"), nil
+			},
+		},
+	})
+	c.Assert(err, qt.IsNil)
+
+	result, err := transpiler.Execute(`
+div { background: asset-url("bg.png"); width: double(12px); }
+@if is-dark(dark) { p { color: #000; } }
+span { content: asset-url("", $fallback: "none"); }
+`)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.CSS, qt.Equals, "div{background:url(/assets/bg.png);width:24px}p{color:#000}span{content:\"none\"}\n")
+
+	_, err = transpiler.Execute("\ndiv { width: double(foo); }")
+	c.Assert(err, qt.Not(qt.IsNil))
+	lerr := err.(libsasserrors.Error)
+	c.Assert(lerr.Line, qt.Equals, 2)
+	c.Assert(lerr.Message, qt.Equals, "error in C function double: expected a number")
+}
+
+func TestFunctionValues(t *testing.T) {
+	c := qt.New(t)
+
+	var got []sassvalue.Value
+
+	transpiler, err := New(Options{
+		OutputStyle: CompressedStyle,
+		Functions: map[string]func(args []sassvalue.Value) (sassvalue.Value, error){
+			"identity($v)": func(args []sassvalue.Value) (sassvalue.Value, error) {
+				got = append(got, args[0])
+				return args[0], nil
+			},
+		},
+	})
+	c.Assert(err, qt.IsNil)
+
+	result, err := transpiler.Execute(`
+$m: identity((primary: #ff0000, sizes: [1px 2em], "on": true));
+div {
+  a: identity(null);
+  b: identity(3.5%);
+  c: identity("quoted");
+  d: identity(unquoted);
+  e: identity(rgba(10, 20, 30, 0.5));
+  f: identity((a, b, c));
+  g: identity([a b]);
+  h: map-get($m, primary);
+  i: nth(map-get($m, sizes), 2);
+  j: map-get($m, "on");
+}
+`)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.CSS, qt.Equals, `div{b:3.5%;c:"quoted";d:unquoted;e:rgba(10,20,30,0.5);f:a,b,c;g:[a b];h:red;i:2em;j:true}`+"\n")
+
+	c.Assert(got, qt.DeepEquals, []sassvalue.Value{
+		sassvalue.Map{Entries: []sassvalue.MapEntry{
+			{Key: sassvalue.String{Value: "primary"}, Value: sassvalue.Color{R: 255, G: 0, B: 0, A: 1}},
+			{Key: sassvalue.String{Value: "sizes"}, Value: sassvalue.List{
+				Items:     []sassvalue.Value{sassvalue.Number{Value: 1, Unit: "px"}, sassvalue.Number{Value: 2, Unit: "em"}},
+				Separator: sassvalue.Space,
+				Bracketed: true,
+			}},
+			{Key: sassvalue.String{Value: "on", Quoted: true}, Value: sassvalue.Bool(true)},
+		}},
+		sassvalue.Null{},
+		sassvalue.Number{Value: 3.5, Unit: "%"},
+		sassvalue.String{Value: "quoted", Quoted: true},
+		sassvalue.String{Value: "unquoted"},
+		sassvalue.Color{R: 10, G: 20, B: 30, A: 0.5},
+		sassvalue.List{
+			Items:     []sassvalue.Value{sassvalue.String{Value: "a"}, sassvalue.String{Value: "b"}, sassvalue.String{Value: "c"}},
+			Separator: sassvalue.Comma,
+		},
+		sassvalue.List{
+			Items:     []sassvalue.Value{sassvalue.String{Value: "a"}, sassvalue.String{Value: "b"}},
+			Separator: sassvalue.Space,
+			Bracketed: true,
+		},
+	})
+}
+
+func TestWarnings(t *testing.T) {
+	c := qt.New(t)
+
+	src := `$sizes: (small: 1px, large: 2px);
+div {
+  @warn "Deprecated: use .box";
+  @debug $sizes;
+  color: #ccc;
+}`
+
+	transpiler, err := New(Options{OutputStyle: CompressedStyle})
+	c.Assert(err, qt.IsNil)
+	result, err := transpiler.Execute(src)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.CSS, qt.Equals, "div{color:#ccc}\n")
+	c.Assert(result.Warnings, qt.DeepEquals, []Message{
+		{Kind: WarningMessage, File: "stdin", Line: 3, Column: 9, Message: "Deprecated: use .box"},
+		{Kind: DebugMessage, File: "stdin", Line: 4, Column: 10, Message: "(small: 1px, large: 2px)"},
+	})
+
+	transpiler, err = New(Options{OutputStyle: CompressedStyle, WarningsAsErrors: true})
+	c.Assert(err, qt.IsNil)
+	_, err = transpiler.Execute(src)
+	c.Assert(err, qt.Not(qt.IsNil))
+	c.Assert(err.Error(), qt.Equals, `file "stdin", line 3, col 9: Warning: Deprecated: use .box `)
+
+	result, err = transpiler.Execute(`@debug "only debug"; div { color: #ccc; }`)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.Warnings, qt.HasLen, 1)
+	c.Assert(result.Warnings[0].Kind.String(), qt.Equals, "debug")
+}
+
+func TestExecuteContext(t *testing.T) {
+	c := qt.New(t)
+
+	c.Run("Deadline in function", func(c *qt.C) {
+		transpiler, err := New(Options{
+			Functions: map[string]func(args []sassvalue.Value) (sassvalue.Value, error){
+				"slow($v)": func(args []sassvalue.Value) (sassvalue.Value, error) {
+					time.Sleep(10 * time.Millisecond)
+					return args[0], nil
+				},
+			},
+		})
+		c.Assert(err, qt.IsNil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err = transpiler.ExecuteContext(ctx, `@for $i from 1 through 10000 { .a-#{$i} { width: slow($i); } }`)
+		c.Assert(err, qt.Equals, context.DeadlineExceeded)
+		c.Assert(time.Since(start) < time.Second, qt.IsTrue)
+	})
+
+	c.Run("Watchdog", func(c *qt.C) {
+		block := make(chan struct{})
+		defer close(block)
+		transpiler, err := New(Options{
+			Functions: map[string]func(args []sassvalue.Value) (sassvalue.Value, error){
+				"block()": func(args []sassvalue.Value) (sassvalue.Value, error) {
+					<-block
+					return sassvalue.Null{}, nil
+				},
+			},
+		})
+		c.Assert(err, qt.IsNil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		_, err = transpiler.ExecuteContext(ctx, `div { a: block(); }`)
+		c.Assert(err, qt.Equals, context.Canceled)
+	})
+
+	c.Run("Cancel in import resolver", func(c *qt.C) {
+		ctx, cancel := context.WithCancel(context.Background())
+		transpiler, err := New(Options{
+			ImportResolver: func(url string, prev string) (string, string, bool) {
+				cancel()
+				return url, `$white: #fff;`, true
+			},
+		})
+		c.Assert(err, qt.IsNil)
+
+		_, err = transpiler.ExecuteContext(ctx, `@import "a"; @import "b";`)
+		c.Assert(err, qt.Equals, context.Canceled)
+	})
+
+	c.Run("Already cancelled", func(c *qt.C) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		transpiler, err := New(Options{})
+		c.Assert(err, qt.IsNil)
+		_, err = transpiler.ExecuteFileContext(ctx, "foo.scss")
+		c.Assert(err, qt.Equals, context.Canceled)
+	})
+
+	c.Run("Not cancelled", func(c *qt.C) {
+		transpiler, err := New(Options{OutputStyle: CompressedStyle})
+		c.Assert(err, qt.IsNil)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		result, err := transpiler.ExecuteContext(ctx, `div { color: #ccc; }`)
+		c.Assert(err, qt.IsNil)
+		c.Assert(result.CSS, qt.Equals, "div{color:#ccc}\n")
+	})
 }
 
 func TestSourceMapSettings(t *testing.T) {
@@ -111,10 +481,200 @@ func TestSourceMapSettings(t *testing.T) {
 	c.Assert(err, qt.IsNil)
 	c.Assert(result.CSS, qt.Equals, "div p {\n  color: blue; }\n\n/*# sourceMappingURL=source.map */")
 	c.Assert(result.SourceMapFilename, qt.Equals, "source.map")
-	c.Assert(`"sourceRoot": "/my/root",`, qt.Contains, `"sourceRoot": "/my/root",`)
-	c.Assert(`"file": "outout.css",`, qt.Contains, `"file": "outout.css",`)
-	c.Assert(`"input.scss",`, qt.Contains, `"input.scss",`)
-	c.Assert(`mappings": "AAGA,AAAM,GAAH,CAAG,CAAC,CAAC;EAAE,KAAK,ECFH,OAAO,GDEM"`, qt.Contains, `mappings": "AAGA,AAAM,GAAH,CAAG,CAAC,CAAC;EAAE,KAAK,ECFH,OAAO,GDEM"`)
+
+	sm := result.SourceMap
+	c.Assert(sm, qt.Not(qt.IsNil))
+	c.Assert(sm.Version, qt.Equals, 3)
+	c.Assert(sm.SourceRoot, qt.Equals, "/my/root")
+	c.Assert(sm.File, qt.Equals, "outout.css")
+	c.Assert(sm.Sources, qt.DeepEquals, []string{"input.scss"})
+	c.Assert(sm.SourcesContent, qt.DeepEquals, []string{src})
+
+	mappings, err := sm.DecodeMappings()
+	c.Assert(err, qt.IsNil)
+	// "color" in "div p {\n  color: blue; }".
+	c.Assert(mappings, qt.Contains, sourcemap.Mapping{
+		GeneratedLine: 1, GeneratedColumn: 2, Source: 0, SourceLine: 0, SourceColumn: 10, Name: -1,
+	})
+	for _, m := range mappings {
+		c.Assert(m.Source, qt.Equals, 0)
+		c.Assert(m.SourceLine, qt.Equals, 0)
+	}
+}
+
+func TestSourceMapSourceRewriter(t *testing.T) {
+	c := qt.New(t)
+
+	newTranspiler := func(opts SourceMapOptions) Transpiler {
+		opts.InputPath = "/build/src/main.scss"
+		opts.SourceRewriter = func(source string) string {
+			return "https://example.com/" + source
+		}
+		transpiler, err := New(Options{
+			OutputStyle:      CompressedStyle,
+			SourceMapOptions: opts,
+			ImportResolver: func(url string, prev string) (string, string, bool) {
+				return "/build/src/_colors.scss", `$primary: #ccc;`, true
+			},
+		})
+		c.Assert(err, qt.IsNil)
+		return transpiler
+	}
+	src := `@import "colors"; a > b { color: $primary; }`
+	want := []string{"https://example.com/src/main.scss", "https://example.com/src/_colors.scss"}
+
+	result, err := newTranspiler(SourceMapOptions{Filename: "/build/main.css.map", Contents: true}).Execute(src)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.SourceMap.Sources, qt.DeepEquals, want)
+	c.Assert(result.SourceMapContent, qt.Contains, `"https://example.com/src/_colors.scss"`)
+	c.Assert(result.SourceMapContent, qt.Contains, "a > b { color: $primary; }")
+
+	result, err = newTranspiler(SourceMapOptions{Filename: "/build/main.css.map", EnableEmbedded: true}).Execute(src)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.CSS, qt.Contains, "a>b{color:#ccc}")
+	prefix := "/*# sourceMappingURL=data:application/json;base64,"
+	i := strings.Index(result.CSS, prefix)
+	c.Assert(i, qt.Not(qt.Equals), -1)
+	c.Assert(strings.HasSuffix(result.CSS, " */"), qt.IsTrue)
+	data, err := base64.StdEncoding.DecodeString(result.CSS[i+len(prefix) : len(result.CSS)-3])
+	c.Assert(err, qt.IsNil)
+	sm, err := sourcemap.Parse(data)
+	c.Assert(err, qt.IsNil)
+	c.Assert(sm.Sources, qt.DeepEquals, want)
+}
+
+func TestSourceMapFileURLs(t *testing.T) {
+	c := qt.New(t)
+	dir := t.TempDir()
+	c.Assert(os.WriteFile(filepath.Join(dir, "_colors.scss"), []byte(`$primary: #ccc;`), 0o644), qt.IsNil)
+	main := filepath.Join(dir, "main.scss")
+	c.Assert(os.WriteFile(main, []byte(`@import "colors"; a { color: $primary; }`), 0o644), qt.IsNil)
+	cwd, err := os.Getwd()
+	c.Assert(err, qt.IsNil)
+
+	transpiler, err := New(Options{
+		IncludePaths: []string{dir},
+		SourceMapOptions: SourceMapOptions{
+			Filename: filepath.Join(dir, "out", "main.css.map"),
+			FileURLs: true,
+		},
+	})
+	c.Assert(err, qt.IsNil)
+
+	result, err := transpiler.Execute(`@import "colors"; a { color: $primary; }`)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.SourceMap.Sources, qt.DeepEquals, []string{
+		"file://" + filepath.ToSlash(filepath.Join(cwd, "stdin")),
+		"file://" + filepath.ToSlash(filepath.Join(dir, "_colors.scss")),
+	})
+
+	result, err = transpiler.ExecuteFile(main)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.SourceMap.Sources, qt.DeepEquals, []string{
+		"file://" + filepath.ToSlash(main),
+		"file://" + filepath.ToSlash(filepath.Join(dir, "_colors.scss")),
+	})
+}
+
+func TestIndentAndLinefeed(t *testing.T) {
+	c := qt.New(t)
+	src := `/* comment */
+div { p { color: blue; } span { color: red; } }
+@media print { a { color: #000; } }`
+
+	for _, style := range []OutputStyle{NestedStyle, ExpandedStyle, CompactStyle, CompressedStyle} {
+		transpiler, err := New(Options{
+			OutputStyle: style,
+			Indent:      "\t",
+			Linefeed:    "\r\n",
+			SourceMapOptions: SourceMapOptions{
+				Filename: "out.css.map",
+			},
+		})
+		c.Assert(err, qt.IsNil)
+
+		result, err := transpiler.Execute(src)
+		c.Assert(err, qt.IsNil)
+		c.Assert(strings.ReplaceAll(result.CSS, "\r\n", ""), qt.Not(qt.Contains), "\n", qt.Commentf("style %d: %q", style, result.CSS))
+		c.Assert(strings.HasSuffix(result.CSS, "\r\n/*# sourceMappingURL=out.css.map */"), qt.IsTrue)
+		if style == NestedStyle || style == ExpandedStyle {
+			c.Assert(result.CSS, qt.Contains, "\r\n\tcolor: blue;")
+			c.Assert(result.CSS, qt.Not(qt.Contains), "  ")
+		}
+	}
+
+	transpiler, err := New(Options{OutputStyle: ExpandedStyle, Indent: "    "})
+	c.Assert(err, qt.IsNil)
+	result, err := transpiler.Execute(`a { color: blue; }`)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.CSS, qt.Equals, "a {\n    color: blue;\n}\n")
+
+	_, err = New(Options{Indent: "--"})
+	c.Assert(err, qt.ErrorMatches, `invalid Indent "--": only spaces and tabs are allowed`)
+	_, err = New(Options{Linefeed: "\n\n"})
+	c.Assert(err, qt.ErrorMatches, `invalid Linefeed "\\n\\n".*`)
+}
+
+func TestSourceComments(t *testing.T) {
+	c := qt.New(t)
+	dir := t.TempDir()
+	c.Assert(os.WriteFile(filepath.Join(dir, "_buttons.scss"), []byte("\n.button { color: red; }"), 0o644), qt.IsNil)
+	main := filepath.Join(dir, "main.scss")
+	c.Assert(os.WriteFile(main, []byte(`@import "buttons"; a { color: blue; }`), 0o644), qt.IsNil)
+	cwd, err := os.Getwd()
+	c.Assert(err, qt.IsNil)
+	rel := func(filename string) string {
+		r, err := filepath.Rel(cwd, filename)
+		c.Assert(err, qt.IsNil)
+		return filepath.ToSlash(r)
+	}
+
+	transpiler, err := New(Options{
+		OutputStyle:    ExpandedStyle,
+		SourceComments: true,
+	})
+	c.Assert(err, qt.IsNil)
+	result, err := transpiler.ExecuteFile(main)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.CSS, qt.Equals, fmt.Sprintf(`/* line 2, %s */
+.button {
+  color: red;
+}
+
+/* line 1, %s */
+a {
+  color: blue;
+}
+`, rel(filepath.Join(dir, "_buttons.scss")), rel(main)))
+
+	transpiler, err = New(Options{
+		OutputStyle:    CompactStyle,
+		SourceComments: true,
+		SourceMapOptions: SourceMapOptions{
+			FileURLs: true,
+			SourceRewriter: func(source string) string {
+				return strings.Replace(source, "file://"+filepath.ToSlash(dir), "https://example.com", 1)
+			},
+		},
+	})
+	c.Assert(err, qt.IsNil)
+	result, err = transpiler.ExecuteFile(main)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.CSS, qt.Equals, `/* line 2, https://example.com/_buttons.scss */ .button { color: red; }
+
+/* line 1, https://example.com/main.scss */ a { color: blue; }
+`)
+
+	transpiler, err = New(Options{
+		OutputStyle:      CompressedStyle,
+		SourceComments:   true,
+		SourceMapOptions: SourceMapOptions{FileURLs: true},
+	})
+	c.Assert(err, qt.IsNil)
+	result, err = transpiler.ExecuteFile(main)
+	c.Assert(err, qt.IsNil)
+	url := "file://" + filepath.ToSlash(dir)
+	c.Assert(result.CSS, qt.Equals, fmt.Sprintf("/* line 2, %s/_buttons.scss */.button{color:red}/* line 1, %s/main.scss */a{color:blue}\n", url, url))
 }
 
 func TestIncludePaths(t *testing.T) {
@@ -155,6 +715,623 @@ div { p { color: $moo; } }`
 	c.Assert(result.CSS, qt.Equals, "content{color:#ccc}div p{color:#f442d1}\n")
 }
 
+func TestExecuteFile(t *testing.T) {
+	c := qt.New(t)
+	dir := t.TempDir()
+
+	writeFile := func(name, content string) string {
+		filename := filepath.Join(dir, name)
+		c.Assert(os.MkdirAll(filepath.Dir(filename), 0o755), qt.IsNil)
+		c.Assert(os.WriteFile(filename, []byte(content), 0o644), qt.IsNil)
+		return filename
+	}
+
+	main := writeFile("main.scss", `@import "partials/colors";
+div { p { color: $primary; } }`)
+	writeFile("partials/_colors.scss", `$primary: #ccc;`)
+	broken := writeFile("broken.scss", `@import "partials/broken";`)
+	writeFile("partials/_broken.scss", "\n\ndiv { color: $blue; }")
+	sass := writeFile("main.sass", "@import \"partials/colors\"\ndiv\n  color: $primary\n")
+
+	transpiler, err := New(Options{
+		OutputStyle: CompressedStyle,
+		SourceMapOptions: SourceMapOptions{
+			Filename:   filepath.Join(dir, "main.css.map"),
+			OutputPath: filepath.Join(dir, "main.css"),
+		},
+	})
+	c.Assert(err, qt.IsNil)
+
+	result, err := transpiler.ExecuteFile(main)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.CSS, qt.Equals, "div p{color:#ccc}\n\n/*# sourceMappingURL=main.css.map */")
+	c.Assert(result.SourceMapContent, qt.Contains, `"sources": [
+		"main.scss",
+		"partials/_colors.scss"
+	]`)
+	c.Assert(result.SourceMap.Sources, qt.DeepEquals, []string{"main.scss", "partials/_colors.scss"})
+	mappings, err := result.SourceMap.DecodeMappings()
+	c.Assert(err, qt.IsNil)
+	// "#ccc" maps to the variable declaration in the partial.
+	c.Assert(mappings, qt.Contains, sourcemap.Mapping{
+		GeneratedLine: 0, GeneratedColumn: 12, Source: 1, SourceLine: 0, SourceColumn: 10, Name: -1,
+	})
+	c.Assert(result.IncludedFiles, qt.DeepEquals, []string{main, filepath.Join(dir, "partials", "_colors.scss")})
+
+	result, err = transpiler.ExecuteFile(sass)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.CSS, qt.Equals, "div{color:#ccc}\n\n/*# sourceMappingURL=main.css.map */")
+
+	_, err = transpiler.ExecuteFile(broken)
+	c.Assert(err, qt.Not(qt.IsNil))
+	lerr := err.(libsasserrors.Error)
+	c.Assert(lerr.File, qt.Equals, filepath.Join(dir, "partials", "_broken.scss"))
+	c.Assert(lerr.Line, qt.Equals, 3)
+
+	_, err = transpiler.ExecuteFile(filepath.Join(dir, "doesnotexist.scss"))
+	c.Assert(err, qt.Not(qt.IsNil))
+}
+
+func TestIncludedFiles(t *testing.T) {
+	c := qt.New(t)
+	dir := t.TempDir()
+
+	for name, content := range map[string]string{
+		"_z.scss":      `@import "a"; @import "virtual";`,
+		"_a.scss":      `@import "m"; $a: 1px;`,
+		"_m.scss":      `$m: 2px;`,
+		"_unused.scss": `$u: 3px;`,
+	} {
+		c.Assert(os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644), qt.IsNil)
+	}
+
+	transpiler, err := New(Options{
+		OutputStyle:  CompressedStyle,
+		IncludePaths: []string{dir},
+		ImportResolver: func(url string, prev string) (string, string, bool) {
+			if url == "virtual" {
+				return "/virtual/_virtual.scss", `$v: 4px;`, true
+			}
+			return "", "", false
+		},
+	})
+	c.Assert(err, qt.IsNil)
+
+	result, err := transpiler.Execute(`@import "z"; @import "m"; div { width: $a + $m + $v; }`)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.CSS, qt.Equals, "div{width:7px}\n")
+	c.Assert(result.IncludedFiles, qt.DeepEquals, []string{
+		filepath.Join(dir, "_z.scss"),
+		filepath.Join(dir, "_a.scss"),
+		filepath.Join(dir, "_m.scss"),
+		"/virtual/_virtual.scss",
+	})
+}
+
+func TestImportResolvers(t *testing.T) {
+	c := qt.New(t)
+	dir := t.TempDir()
+	c.Assert(os.WriteFile(filepath.Join(dir, "_content.scss"), []byte(`content { color: #ccc; }`), 0o644), qt.IsNil)
+
+	var calls []string
+	resolver := func(name string, bodies map[string]string) func(imp Import) (string, string, bool, error) {
+		return func(imp Import) (string, string, bool, error) {
+			calls = append(calls, name+":"+imp.URL)
+			body, ok := bodies[imp.URL]
+			return imp.URL, body, ok, nil
+		}
+	}
+
+	transpiler, err := New(Options{
+		OutputStyle:  CompressedStyle,
+		IncludePaths: []string{dir},
+		ImportResolver: func(url string, prev string) (string, string, bool) {
+			calls = append(calls, "legacy:"+url)
+			return url, `$legacy: 4px;`, url == "legacy"
+		},
+		ImportResolvers: []ImportResolverEntry{
+			{Name: "theme", Priority: 5, Resolve: resolver("theme", map[string]string{"colors": `$c: red;`})},
+			{Name: "fallback", Priority: 5, Resolve: resolver("fallback", map[string]string{"colors": `$c: blue;`, "other": `$o: 1px;`})},
+			{Name: "virtual", Priority: 10, Resolve: resolver("virtual", map[string]string{"virtual": `$v: 2px;`})},
+		},
+	})
+	c.Assert(err, qt.IsNil)
+
+	result, err := transpiler.Execute(`@import "colors", "other", "virtual", "legacy", "content";
+div { color: $c; width: $o + $v + $legacy; }`)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.CSS, qt.Equals, "content{color:#ccc}div{color:red;width:7px}\n")
+	c.Assert(calls, qt.DeepEquals, []string{
+		"virtual:colors", "theme:colors",
+		"virtual:other", "theme:other", "fallback:other",
+		"virtual:virtual",
+		"virtual:legacy", "theme:legacy", "fallback:legacy", "legacy:legacy",
+		"virtual:content", "theme:content", "fallback:content", "legacy:content",
+	})
+
+	_, err = New(Options{ImportResolvers: []ImportResolverEntry{{Name: "nil"}}})
+	c.Assert(err, qt.ErrorMatches, `import resolver "nil": Resolve is nil`)
+}
+
+func TestImportResolverError(t *testing.T) {
+	c := qt.New(t)
+
+	transpiler, err := New(Options{
+		ImportResolvers: []ImportResolverEntry{
+			{
+				Name: "forbidden",
+				Resolve: func(imp Import) (string, string, bool, error) {
+					switch imp.URL {
+					case "forbidden":
+						return "", "", false, errors.New("this import is forbidden")
+					case "partial":
+						return "partial.scss", "\n@import \"forbidden\";", true, nil
+					}
+					return "", "", false, nil
+				},
+			},
+		},
+	})
+	c.Assert(err, qt.IsNil)
+
+	_, err = transpiler.Execute("div { color: #ccc; }\n@import \"forbidden\";")
+	c.Assert(err, qt.Not(qt.IsNil))
+	lerr := err.(libsasserrors.Error)
+	c.Assert(lerr.File, qt.Equals, "stdin")
+	c.Assert(lerr.Line, qt.Equals, 2)
+	c.Assert(lerr.Column, qt.Equals, 9)
+	c.Assert(lerr.Message, qt.Equals, "this import is forbidden")
+
+	_, err = transpiler.Execute(`@import "partial";`)
+	c.Assert(err, qt.Not(qt.IsNil))
+	lerr = err.(libsasserrors.Error)
+	c.Assert(lerr.File, qt.Equals, "partial.scss")
+	c.Assert(lerr.Line, qt.Equals, 2)
+	c.Assert(lerr.Message, qt.Equals, "this import is forbidden")
+	c.Assert(errors.Unwrap(err), qt.ErrorMatches, "this import is forbidden")
+}
+
+func TestIncludeFS(t *testing.T) {
+	c := qt.New(t)
+
+	theme := fstest.MapFS{
+		"_colors.scss":                 {Data: []byte(`$primary: red;`)},
+		"components/_buttons.scss":     {Data: []byte(`@import "mixins"; .btn { @include pad; }`)},
+		"components/_mixins.scss":      {Data: []byte(`@mixin pad { padding: 1px; }`)},
+		"layout/_index.scss":           {Data: []byte(`.layout { display: grid; }`)},
+		"legacy.sass":                  {Data: []byte("$legacy: 2px\n")},
+		"_dup.scss":                    {Data: []byte(``)},
+		"dup.scss":                     {Data: []byte(``)},
+		"looks-like-a-file.scss/x.css": {Data: []byte(``)},
+	}
+	overlay := fstest.MapFS{
+		"_mixins.scss": {Data: []byte(`@mixin pad { padding: 2px; }`)},
+		"extra.css":    {Data: []byte(`.extra { color: blue; }`)},
+	}
+
+	transpiler, err := New(Options{
+		OutputStyle: CompressedStyle,
+		IncludeFS:   []fs.FS{theme, overlay},
+	})
+	c.Assert(err, qt.IsNil)
+
+	result, err := transpiler.Execute(`@import "colors", "components/buttons", "layout", "legacy", "extra";
+@import "mixins";
+div { color: $primary; width: $legacy; @include pad; }`)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.CSS, qt.Equals, ".btn{padding:1px}.layout{display:grid}.extra{color:blue}div{color:red;width:2px;padding:2px}\n")
+	c.Assert(result.IncludedFiles, qt.DeepEquals, []string{
+		"includefs:0/_colors.scss",
+		"includefs:0/components/_buttons.scss",
+		"includefs:0/components/_mixins.scss",
+		"includefs:0/layout/_index.scss",
+		"includefs:0/legacy.sass",
+		"includefs:1/extra.css",
+		"includefs:1/_mixins.scss",
+	})
+
+	_, err = transpiler.Execute(`@import "dup";`)
+	c.Assert(err, qt.Not(qt.IsNil))
+	c.Assert(err.(libsasserrors.Error).Message, qt.Equals, `It's not clear which file to import for '@import "dup"'.
+Candidates:
+  _dup.scss
+  dup.scss
+Please delete or rename all but one of these files.
+`)
+
+	_, err = transpiler.Execute(`@import "looks-like-a-file.scss";`)
+	c.Assert(err, qt.Not(qt.IsNil))
+
+	c.Run("Disk before FS", func(c *qt.C) {
+		dir := t.TempDir()
+		main := filepath.Join(dir, "main.scss")
+		colors := filepath.Join(dir, "_colors.scss")
+		c.Assert(os.WriteFile(main, []byte(`@import "colors", "legacy"; div { color: $primary; width: $legacy; }`), 0o644), qt.IsNil)
+		c.Assert(os.WriteFile(colors, []byte(`$primary: blue;`), 0o644), qt.IsNil)
+
+		result, err := transpiler.ExecuteFile(main)
+		c.Assert(err, qt.IsNil)
+		c.Assert(result.CSS, qt.Equals, "div{color:blue;width:2px}\n")
+		c.Assert(result.IncludedFiles, qt.DeepEquals, []string{main, colors, "includefs:0/legacy.sass"})
+
+		graph := NewDependencyGraph()
+		graph.Update(main, result, err)
+		c.Assert(graph.Dependencies(main), qt.DeepEquals, []string{colors, main})
+
+		// LibSass looks in the working directory for imports from stdin.
+		c.Chdir(dir)
+		result, err = transpiler.Execute(`@import "colors"; div { color: $primary; }`)
+		c.Assert(err, qt.IsNil)
+		c.Assert(result.CSS, qt.Equals, "div{color:blue}\n")
+	})
+}
+
+func TestImportStack(t *testing.T) {
+	c := qt.New(t)
+	dir := t.TempDir()
+	c.Assert(os.WriteFile(filepath.Join(dir, "_a.scss"), []byte(`@import "b";`), 0o644), qt.IsNil)
+
+	var stacks [][]ImportStackEntry
+	var prevs []string
+
+	transpiler, err := New(Options{
+		IncludePaths: []string{dir},
+		ImportResolvers: []ImportResolverEntry{
+			{
+				Name: "virtual",
+				Resolve: func(imp Import) (string, string, bool, error) {
+					stacks = append(stacks, imp.Stack)
+					prevs = append(prevs, imp.Prev)
+					switch imp.URL {
+					case "b":
+						return "/virtual/b.scss", `@import "c";`, true, nil
+					case "c":
+						return "/virtual/c.scss", `$c: 1px;`, true, nil
+					}
+					return "", "", false, nil
+				},
+			},
+		},
+	})
+	c.Assert(err, qt.IsNil)
+
+	_, err = transpiler.Execute(`@import "a";`)
+	c.Assert(err, qt.IsNil)
+	// LibSass uses the resolved file name as the import path for files
+	// found in the include paths.
+	c.Assert(prevs, qt.DeepEquals, []string{"stdin", "_a.scss", "b"})
+	c.Assert(stacks, qt.HasLen, 3)
+	c.Assert(stacks[2], qt.HasLen, 3)
+	c.Assert(stacks[2][0].ImpPath, qt.Equals, "stdin")
+	c.Assert(stacks[2][1], qt.DeepEquals, ImportStackEntry{ImpPath: "_a.scss", AbsPath: filepath.Join(dir, "_a.scss")})
+	c.Assert(stacks[2][2], qt.DeepEquals, ImportStackEntry{ImpPath: "b", AbsPath: "/virtual/b.scss"})
+}
+
+func TestImportChain(t *testing.T) {
+	c := qt.New(t)
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		filename := filepath.Join(dir, name)
+		c.Assert(os.WriteFile(filename, []byte(content), 0o644), qt.IsNil)
+		return filename
+	}
+	main := writeFile("main.scss", "$x: 1;\n@import \"a\";\n")
+	a := writeFile("_a.scss", "a {\n  @import \"b\";\n}\n")
+	b := writeFile("_b.scss", "@warn \"b\";\n")
+
+	transpiler, err := New(Options{})
+	c.Assert(err, qt.IsNil)
+
+	result, err := transpiler.ExecuteFile(main)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.Warnings, qt.HasLen, 1)
+	c.Assert(result.Warnings[0].File, qt.Equals, b)
+	c.Assert(result.Warnings[0].ImportChain, qt.DeepEquals, []libsasserrors.ImportSite{
+		{File: a, Line: 2, Column: 3},
+		{File: main, Line: 2, Column: 1},
+	})
+
+	assertErrorChain := func(want ...libsasserrors.ImportSite) {
+		c.Helper()
+		_, err := transpiler.ExecuteFile(main)
+		var lerr libsasserrors.Error
+		c.Assert(errors.As(err, &lerr), qt.IsTrue)
+		c.Assert(lerr.Details.ImportChain, qt.DeepEquals, want)
+	}
+
+	// Runtime error.
+	writeFile("_b.scss", "b { c: $undefined; }\n")
+	assertErrorChain(libsasserrors.ImportSite{File: a, Line: 2, Column: 3}, libsasserrors.ImportSite{File: main, Line: 2, Column: 1})
+
+	// Syntax error while the importing files are still being parsed.
+	writeFile("_b.scss", "b {\n")
+	assertErrorChain(libsasserrors.ImportSite{File: a, Line: 2, Column: 3}, libsasserrors.ImportSite{File: main, Line: 2, Column: 1})
+
+	// The error is in the importing file.
+	writeFile("_a.scss", "@import \"nope\";\n")
+	assertErrorChain(libsasserrors.ImportSite{File: main, Line: 2, Column: 1})
+
+	// The entry has no import chain.
+	_, err = transpiler.Execute("a {")
+	var lerr libsasserrors.Error
+	c.Assert(errors.As(err, &lerr), qt.IsTrue)
+	c.Assert(lerr.Details.ImportChain, qt.IsNil)
+}
+
+func TestVariables(t *testing.T) {
+	c := qt.New(t)
+
+	transpiler, err := New(Options{
+		OutputStyle: CompressedStyle,
+		SourceMapOptions: SourceMapOptions{
+			Filename: "out.css.map",
+			OmitURL:  true,
+		},
+		Variables: map[string]any{
+			"$primary":  "#ff0000",
+			"font-size": "16px",
+			"scale":     1.5,
+			"enabled":   true,
+			"family":    "Helvetica",
+			"accent":    "red",
+			"margins":   "1px 2px",
+			"fonts":     "'Open Sans', Arial",
+			"border":    "1px solid #000",
+			"logo":      "https://cdn.example.com/logo.png",
+			"themes":    []string{"red", "blue"},
+			"label":     sassvalue.String{Value: "Hi", Quoted: true},
+			"black":     color.NRGBA{A: 255},
+			"sizes":     []string{"1px", "2px"},
+			"breakpoints": map[string]any{
+				"small": "576px",
+				"large": 992,
+			},
+		},
+	})
+	c.Assert(err, qt.IsNil)
+
+	result, err := transpiler.Execute(`
+a {
+  color: darken($primary, 10%);
+  font: $font-size * $scale $family;
+  content: $label;
+  border-color: $black;
+  padding: nth($sizes, 2);
+  outline-color: darken($accent, 10%);
+  margin: nth($margins, 2) length($fonts);
+  font-family: nth($fonts, 1);
+  border: $border;
+  border-left-color: lighten(nth($border, 3), 20%);
+  background: url($logo);
+  background-color: darken(nth($themes, 2), 10%);
+  @if $enabled { width: map-get($breakpoints, small) + map-get($breakpoints, large); }
+}`)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.CSS, qt.Equals, `a{color:#c00;font:24px Helvetica;content:"Hi";border-color:#000;padding:2px;outline-color:#c00;margin:2px 2;font-family:"Open Sans";border:1px solid #000;border-left-color:#333;background:url(https://cdn.example.com/logo.png);background-color:#00c;width:1568px}`+"\n")
+	c.Assert(result.IncludedFiles, qt.HasLen, 0)
+	c.Assert(result.SourceMapContent, qt.Contains, `"sources": [
+		"stdin",
+		"golibsass-variables"
+	]`)
+
+	// The positions in the source are not shifted.
+	_, err = transpiler.Execute("a {\n  color: $undefined;\n}")
+	c.Assert(err, qt.Not(qt.IsNil))
+	lerr := err.(libsasserrors.Error)
+	c.Assert(lerr.Line, qt.Equals, 2)
+	c.Assert(lerr.Message, qt.Equals, "Undefined variable: \"$undefined\".")
+
+	_, err = New(Options{Variables: map[string]any{"foo bar": 1}})
+	c.Assert(err, qt.ErrorMatches, `invalid variable name "foo bar"`)
+	_, err = New(Options{Variables: map[string]any{"foo": struct{}{}}})
+	c.Assert(err, qt.ErrorMatches, `variable "foo": unsupported Go type struct {}`)
+	_, err = New(Options{Variables: map[string]any{"$foo": 1, "foo": 2}})
+	c.Assert(err, qt.ErrorMatches, `duplicate variable "foo"`)
+}
+
+func TestHeaders(t *testing.T) {
+	c := qt.New(t)
+	dir := t.TempDir()
+	c.Assert(os.WriteFile(filepath.Join(dir, "_mixins.scss"), []byte(`@import "factor"; @mixin big { font-size: $size * $factor; }`), 0o644), qt.IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dir, "_factor.scss"), []byte(`$factor: 2;`), 0o644), qt.IsNil)
+
+	transpiler, err := New(Options{
+		OutputStyle:  CompressedStyle,
+		IncludePaths: []string{dir},
+		Variables:    map[string]any{"base": "8px"},
+		Headers: []Header{
+			{Path: "shared/_variables.scss", Body: `$size: $base * 2;`},
+			{Path: "mixins"},
+		},
+	})
+	c.Assert(err, qt.IsNil)
+
+	result, err := transpiler.Execute(`a { @include big; }`)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.CSS, qt.Equals, "a{font-size:32px}\n")
+	// Only the headers loaded from disk and their imports.
+	c.Assert(result.IncludedFiles, qt.DeepEquals, []string{filepath.Join(dir, "_mixins.scss"), filepath.Join(dir, "_factor.scss")})
+
+	transpiler, err = New(Options{
+		Headers: []Header{
+			{Path: "shared/_variables.scss", Body: "$a: 1px;\n$b: $undefined;"},
+		},
+	})
+	c.Assert(err, qt.IsNil)
+	_, err = transpiler.Execute(`a { width: $a; }`)
+	c.Assert(err, qt.Not(qt.IsNil))
+	lerr := err.(libsasserrors.Error)
+	c.Assert(lerr.File, qt.Equals, "shared/_variables.scss")
+	c.Assert(lerr.Line, qt.Equals, 2)
+
+	_, err = New(Options{Headers: []Header{{Body: "$a: 1px;"}}})
+	c.Assert(err, qt.ErrorMatches, `header 0: Path is required`)
+}
+
+func TestCache(t *testing.T) {
+	c := qt.New(t)
+
+	for _, backend := range []struct {
+		name    string
+		backend func() CacheBackend
+	}{
+		{"memory", func() CacheBackend { return NewMemoryCache(10) }},
+		{"dir", func() CacheBackend { return NewDirCache(filepath.Join(t.TempDir(), "cache")) }},
+	} {
+		c.Run(backend.name, func(c *qt.C) {
+			dir := t.TempDir()
+			colors := filepath.Join(dir, "_colors.scss")
+			c.Assert(os.WriteFile(colors, []byte(`$primary: #ccc;`), 0o644), qt.IsNil)
+			main := filepath.Join(dir, "main.scss")
+			c.Assert(os.WriteFile(main, []byte(`@import "colors"; a { color: $primary; width: count(); }`), 0o644), qt.IsNil)
+
+			var calls int
+			options := Options{
+				OutputStyle:  CompressedStyle,
+				IncludePaths: []string{dir},
+				Functions: map[string]func(args []sassvalue.Value) (sassvalue.Value, error){
+					"count()": func(args []sassvalue.Value) (sassvalue.Value, error) {
+						calls++
+						return sassvalue.Number{Value: 1, Unit: "px"}, nil
+					},
+				},
+			}
+			cacheBackend := backend.backend()
+			transpiler, err := NewCached(options, CacheOptions{Backend: cacheBackend})
+			c.Assert(err, qt.IsNil)
+
+			src := `@import "colors"; b { color: $primary; width: count(); }`
+			for i := 0; i < 3; i++ {
+				result, err := transpiler.Execute(src)
+				c.Assert(err, qt.IsNil)
+				c.Assert(result.CSS, qt.Equals, "b{color:#ccc;width:1px}\n")
+				result, err = transpiler.ExecuteFile(main)
+				c.Assert(err, qt.IsNil)
+				c.Assert(result.CSS, qt.Equals, "a{color:#ccc;width:1px}\n")
+				c.Assert(result.IncludedFiles, qt.DeepEquals, []string{main, colors})
+			}
+			c.Assert(calls, qt.Equals, 2)
+
+			// Changing a dependency invalidates both.
+			c.Assert(os.WriteFile(colors, []byte(`$primary: #ddd;`), 0o644), qt.IsNil)
+			result, err := transpiler.Execute(src)
+			c.Assert(err, qt.IsNil)
+			c.Assert(result.CSS, qt.Equals, "b{color:#ddd;width:1px}\n")
+			result, err = transpiler.ExecuteFile(main)
+			c.Assert(err, qt.IsNil)
+			c.Assert(result.CSS, qt.Equals, "a{color:#ddd;width:1px}\n")
+			c.Assert(calls, qt.Equals, 4)
+
+			// Different options, different key.
+			options.OutputStyle = ExpandedStyle
+			transpiler2, err := NewCached(options, CacheOptions{Backend: cacheBackend})
+			c.Assert(err, qt.IsNil)
+			_, err = transpiler2.Execute(src)
+			c.Assert(err, qt.IsNil)
+			c.Assert(calls, qt.Equals, 5)
+
+			// Errors are not cached.
+			for i := 0; i < 2; i++ {
+				_, err = transpiler.Execute(`a { width: count(); color: $undefined; }`)
+				c.Assert(err, qt.Not(qt.IsNil))
+			}
+			c.Assert(calls, qt.Equals, 7)
+		})
+	}
+
+	c.Run("Header from disk", func(c *qt.C) {
+		dir := t.TempDir()
+		mixins := filepath.Join(dir, "_mixins.scss")
+		c.Assert(os.WriteFile(mixins, []byte(`@mixin big { font-size: 2px; }`), 0o644), qt.IsNil)
+
+		transpiler, err := NewCached(Options{
+			OutputStyle:  CompressedStyle,
+			IncludePaths: []string{dir},
+			Headers:      []Header{{Path: "mixins"}},
+		}, CacheOptions{})
+		c.Assert(err, qt.IsNil)
+
+		result, err := transpiler.Execute(`a { @include big; }`)
+		c.Assert(err, qt.IsNil)
+		c.Assert(result.CSS, qt.Equals, "a{font-size:2px}\n")
+
+		c.Assert(os.WriteFile(mixins, []byte(`@mixin big { font-size: 3px; }`), 0o644), qt.IsNil)
+		result, err = transpiler.Execute(`a { @include big; }`)
+		c.Assert(err, qt.IsNil)
+		c.Assert(result.CSS, qt.Equals, "a{font-size:3px}\n")
+	})
+}
+
+func TestMemoryCacheEviction(t *testing.T) {
+	c := qt.New(t)
+	cache := NewMemoryCache(2)
+	c.Assert(cache.Set("a", []byte("a")), qt.IsNil)
+	c.Assert(cache.Set("b", []byte("b")), qt.IsNil)
+	_, found, _ := cache.Get("a")
+	c.Assert(found, qt.IsTrue)
+	c.Assert(cache.Set("c", []byte("c")), qt.IsNil)
+	_, found, _ = cache.Get("b")
+	c.Assert(found, qt.IsFalse)
+	v, found, _ := cache.Get("a")
+	c.Assert(found, qt.IsTrue)
+	c.Assert(string(v), qt.Equals, "a")
+}
+
+func TestDependencyGraph(t *testing.T) {
+	c := qt.New(t)
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		filename := filepath.Join(dir, name)
+		c.Assert(os.WriteFile(filename, []byte(content), 0o644), qt.IsNil)
+		return filename
+	}
+
+	colors := writeFile("_colors.scss", `$primary: #ccc;`)
+	mixins := writeFile("_mixins.scss", `@import "colors"; @mixin primary { color: $primary; }`)
+	main := writeFile("main.scss", `@import "mixins"; a { @include primary; }`)
+	other := writeFile("other.scss", `@import "colors"; b { color: $primary; }`)
+	standalone := writeFile("standalone.scss", `c { color: red; }`)
+
+	transpiler, err := New(Options{})
+	c.Assert(err, qt.IsNil)
+	graph := NewDependencyGraph()
+
+	var wg sync.WaitGroup
+	for _, entry := range []string{main, other, standalone} {
+		wg.Add(1)
+		go func(entry string) {
+			defer wg.Done()
+			result, err := transpiler.ExecuteFile(entry)
+			graph.Update(entry, result, err)
+		}(entry)
+	}
+	wg.Wait()
+
+	c.Assert(graph.Entries(), qt.DeepEquals, []string{main, other, standalone})
+	c.Assert(graph.Dependencies(main), qt.DeepEquals, []string{colors, mixins, main})
+	c.Assert(graph.Affected(colors), qt.DeepEquals, []string{main, other})
+	c.Assert(graph.Affected(mixins, standalone), qt.DeepEquals, []string{main, standalone})
+	c.Assert(graph.Affected(filepath.Join(dir, "unknown.scss")), qt.IsNil)
+
+	// A broken partial keeps the previous dependencies.
+	writeFile("_mixins.scss", `@mixin primary { color: $undefined; }`)
+	result, err := transpiler.ExecuteFile(main)
+	c.Assert(err, qt.Not(qt.IsNil))
+	graph.Update(main, result, err)
+	c.Assert(graph.Dependencies(main), qt.DeepEquals, []string{colors, mixins, main})
+
+	// Fixed, without the colors import.
+	writeFile("_mixins.scss", `@mixin primary { color: blue; }`)
+	result, err = transpiler.ExecuteFile(main)
+	c.Assert(err, qt.IsNil)
+	graph.Update(main, result, err)
+	c.Assert(graph.Dependencies(main), qt.DeepEquals, []string{mixins, main})
+	c.Assert(graph.Affected(colors), qt.DeepEquals, []string{other})
+
+	graph.Remove(other)
+	c.Assert(graph.Affected(colors), qt.IsNil)
+}
+
 func TestConcurrentTranspile(t *testing.T) {
 	c := qt.New(t)
 
@@ -0,0 +1,455 @@
+// Copyright © 2022 Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package watch recompiles Sass entry files when they or any of their
+// dependencies change.
+package watch
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bep/golibsass/libsass"
+)
+
+// Entry is a Sass file to compile.
+type Entry struct {
+	// The Sass file to compile.
+	Filename string
+
+	// If set, the CSS is written to this file.
+	Target string
+
+	// If set and a source map is generated, it is written to this file.
+	SourceMapTarget string
+
+	// If set, used to compile this entry instead of Config.Options, e.g. to
+	// set the source map options for each entry.
+	Options *libsass.Options
+}
+
+// Config configures Watch.
+type Config struct {
+	// The entries to compile.
+	Entries []Entry
+
+	// The options used to compile the entries.
+	Options libsass.Options
+
+	// Dirs are more directories, including their subdirectories, to watch
+	// for new and removed files, e.g. to find new entries with Find.
+	Dirs []string
+
+	// Find, if set, returns entries to compile in addition to Entries, e.g.
+	// all the non-partial Sass files in a directory.
+	// It is called on start and when files change; the new entries are
+	// compiled and the entries no longer returned are dropped.
+	Find func() ([]Entry, error)
+
+	// How often to check the files for changes. Default is 500ms.
+	Interval time.Duration
+
+	// How long to wait for a burst of changes to settle before recompiling.
+	// Default is 100ms.
+	Debounce time.Duration
+}
+
+// Event is the result of compiling an entry.
+type Event struct {
+	Entry  Entry
+	Result libsass.Result
+
+	// The compile error or the error writing the targets, if any.
+	// For errors from Config.Find, Entry is zero.
+	Err error
+}
+
+// Watch compiles all entries, then polls their dependencies for changes and
+// recompiles the affected entries until ctx is done.
+//
+// New files are noticed in the directories of the entries and their
+// dependencies, and in Options.IncludePaths, and make the entries that failed
+// to compile, e.g. because of a missing partial, recompile. For the entries
+// that failed, the entry directory and the include paths are also searched
+// recursively, so a missing partial in a subdirectory is noticed too.
+//
+// The results are delivered on the returned channel, which is closed when
+// ctx is done.
+func Watch(ctx context.Context, cfg Config) (<-chan Event, error) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 500 * time.Millisecond
+	}
+	if cfg.Debounce <= 0 {
+		cfg.Debounce = 100 * time.Millisecond
+	}
+
+	transpiler, err := libsass.New(cfg.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &watcher{
+		cfg:        cfg,
+		transpiler: transpiler,
+		graph:      libsass.NewDependencyGraph(),
+		entries:    make(map[string]watchedEntry),
+		found:      make(map[string]bool),
+		failed:     make(map[string]bool),
+		events:     make(chan Event, len(cfg.Entries)),
+	}
+	for _, entry := range cfg.Entries {
+		filename, err := filepath.Abs(entry.Filename)
+		if err != nil {
+			return nil, err
+		}
+		if err := w.add(filename, entry); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Find != nil {
+		if _, err := w.find(); err != nil {
+			return nil, err
+		}
+	}
+
+	go w.run(ctx)
+
+	return w.events, nil
+}
+
+type watcher struct {
+	cfg        Config
+	transpiler libsass.Transpiler
+	graph      *libsass.DependencyGraph
+
+	// Maps the absolute entry filenames to the entries.
+	entries map[string]watchedEntry
+
+	// The absolute entry filenames in the order they were added.
+	order []string
+
+	// The entries returned by Config.Find.
+	found map[string]bool
+
+	// The entries that failed to compile.
+	failed map[string]bool
+
+	events chan Event
+}
+
+type watchedEntry struct {
+	entry      Entry
+	transpiler libsass.Transpiler
+}
+
+// fileInfo is what we compare to detect changes.
+type fileInfo struct {
+	modTime time.Time
+	size    int64
+}
+
+func (w *watcher) run(ctx context.Context) {
+	defer close(w.events)
+
+	files := w.snapshot()
+	if !w.compile(ctx, w.order) {
+		return
+	}
+	files = merge(files, w.snapshot())
+
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current := w.snapshot()
+		changed, added := diff(files, current)
+		if len(changed) == 0 {
+			continue
+		}
+
+		// Debounce, wait until nothing changes for a while.
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(w.cfg.Debounce):
+			}
+			next := w.snapshot()
+			c, a := diff(current, next)
+			if len(c) == 0 {
+				break
+			}
+			changed = append(changed, c...)
+			added = added || a
+			current = next
+		}
+
+		affected := w.graph.Affected(changed...)
+		if added {
+			for filename := range w.failed {
+				affected = append(affected, filename)
+			}
+		}
+		if w.cfg.Find != nil {
+			newEntries, err := w.find()
+			if err != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case w.events <- Event{Err: err}:
+				}
+			}
+			affected = append(affected, newEntries...)
+		}
+		if !w.compile(ctx, w.graphEntries(affected)) {
+			return
+		}
+		// The dependencies may have changed.
+		files = merge(current, w.snapshot())
+	}
+}
+
+// merge adds the files in after that are not in before to before.
+// before is taken before compiling, so the changes to the files we already
+// knew about made while compiling are picked up in the next round.
+func merge(before, after map[string]fileInfo) map[string]fileInfo {
+	for filename, fi := range after {
+		if _, found := before[filename]; !found {
+			before[filename] = fi
+		}
+	}
+	return before
+}
+
+// add adds entry with the absolute filename.
+func (w *watcher) add(filename string, entry Entry) error {
+	transpiler := w.transpiler
+	if entry.Options != nil {
+		var err error
+		if transpiler, err = libsass.New(*entry.Options); err != nil {
+			return err
+		}
+	}
+	w.entries[filename] = watchedEntry{entry: entry, transpiler: transpiler}
+	w.order = append(w.order, filename)
+	return nil
+}
+
+// remove removes the entry with the absolute filename.
+func (w *watcher) remove(filename string) {
+	delete(w.entries, filename)
+	delete(w.found, filename)
+	delete(w.failed, filename)
+	w.graph.Remove(filename)
+	for i, f := range w.order {
+		if f == filename {
+			w.order = append(w.order[:i], w.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// find updates the entries from Config.Find and returns the new ones.
+func (w *watcher) find() ([]string, error) {
+	entries, err := w.cfg.Find()
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool, len(entries))
+	var added []string
+	for _, entry := range entries {
+		filename, err := filepath.Abs(entry.Filename)
+		if err != nil {
+			return nil, err
+		}
+		found[filename] = true
+		if _, exists := w.entries[filename]; exists {
+			continue
+		}
+		if err := w.add(filename, entry); err != nil {
+			return nil, err
+		}
+		w.found[filename] = true
+		added = append(added, filename)
+	}
+	for filename := range w.found {
+		if !found[filename] {
+			w.remove(filename)
+		}
+	}
+	return added, nil
+}
+
+// graphEntries returns the entries for the given filenames in the order
+// they were added.
+func (w *watcher) graphEntries(filenames []string) []string {
+	want := make(map[string]bool, len(filenames))
+	for _, filename := range filenames {
+		want[filename] = true
+	}
+	var entries []string
+	for _, filename := range w.order {
+		if want[filename] {
+			entries = append(entries, filename)
+		}
+	}
+	return entries
+}
+
+// compile compiles the given entries and sends the events.
+// It returns false if ctx is done.
+func (w *watcher) compile(ctx context.Context, filenames []string) bool {
+	for _, filename := range filenames {
+		we := w.entries[filename]
+		entry := we.entry
+		result, err := we.transpiler.ExecuteFileContext(ctx, entry.Filename)
+		w.graph.Update(filename, result, err)
+		if err != nil {
+			w.failed[filename] = true
+		} else {
+			delete(w.failed, filename)
+			err = writeTargets(entry, result)
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case w.events <- Event{Entry: entry, Result: result, Err: err}:
+		}
+	}
+	return true
+}
+
+func writeTargets(entry Entry, result libsass.Result) error {
+	write := func(filename, content string) error {
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(filename, []byte(content), 0o644)
+	}
+	if entry.Target != "" {
+		if err := write(entry.Target, result.CSS); err != nil {
+			return err
+		}
+	}
+	if entry.SourceMapTarget != "" && result.SourceMapContent != "" {
+		if err := write(entry.SourceMapTarget, result.SourceMapContent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshot returns the state of the dependencies of all entries and of the
+// Sass files in the directories to watch for new files.
+func (w *watcher) snapshot() map[string]fileInfo {
+	files := make(map[string]fileInfo)
+	dirs := make(map[string]bool)
+	for _, dir := range w.cfg.Options.IncludePaths {
+		dirs[dir] = true
+	}
+
+	stat := func(filename string) {
+		if fi, err := os.Stat(filename); err == nil && !fi.IsDir() {
+			files[filename] = fileInfo{modTime: fi.ModTime(), size: fi.Size()}
+		}
+	}
+
+	trees := make(map[string]bool)
+	for _, dir := range w.cfg.Dirs {
+		trees[dir] = true
+	}
+
+	for filename, we := range w.entries {
+		var includePaths []string
+		if we.entry.Options != nil {
+			includePaths = we.entry.Options.IncludePaths
+		}
+		for _, dir := range includePaths {
+			dirs[dir] = true
+		}
+		if w.failed[filename] {
+			// An unresolved import of a failed entry may be fixed by a new
+			// file in any subdirectory it can be resolved from.
+			trees[filepath.Dir(filename)] = true
+			for _, dir := range includePaths {
+				trees[dir] = true
+			}
+			for _, dir := range w.cfg.Options.IncludePaths {
+				trees[dir] = true
+			}
+		}
+		// The entry may have failed and not be in the graph.
+		stat(filename)
+		dirs[filepath.Dir(filename)] = true
+		for _, dep := range w.graph.Dependencies(filename) {
+			stat(dep)
+			dirs[filepath.Dir(dep)] = true
+		}
+	}
+
+	for dir := range trees {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && isSassFile(path) {
+				stat(path)
+			}
+			return nil
+		})
+	}
+
+	for dir := range dirs {
+		if trees[dir] {
+			continue
+		}
+		des, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, de := range des {
+			if !de.IsDir() && isSassFile(de.Name()) {
+				stat(filepath.Join(dir, de.Name()))
+			}
+		}
+	}
+
+	return files
+}
+
+func isSassFile(filename string) bool {
+	switch filepath.Ext(filename) {
+	case ".scss", ".sass", ".css":
+		return true
+	}
+	return false
+}
+
+// diff returns the files that were added, removed or modified between
+// before and after, and whether any were added.
+func diff(before, after map[string]fileInfo) (changed []string, added bool) {
+	for filename, fi := range after {
+		prev, found := before[filename]
+		if !found {
+			added = true
+		}
+		if !found || !prev.modTime.Equal(fi.modTime) || prev.size != fi.size {
+			changed = append(changed, filename)
+		}
+	}
+	for filename := range before {
+		if _, found := after[filename]; !found {
+			changed = append(changed, filename)
+		}
+	}
+	return
+}
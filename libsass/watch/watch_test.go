@@ -0,0 +1,269 @@
+// Copyright © 2022 Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bep/golibsass/libsass"
+	"github.com/bep/golibsass/libsass/sassvalue"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestWatch(t *testing.T) {
+	c := qt.New(t)
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		filename := filepath.Join(dir, name)
+		c.Assert(os.WriteFile(filename, []byte(content), 0o644), qt.IsNil)
+		return filename
+	}
+
+	main := writeFile("main.scss", `@import "colors"; a { color: $primary; }`)
+	other := writeFile("other.scss", `b { color: red; }`)
+	target := filepath.Join(dir, "out", "main.css")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := Watch(ctx, Config{
+		Entries: []Entry{
+			{Filename: main, Target: target},
+			{Filename: other},
+		},
+		Options:  libsass.Options{OutputStyle: libsass.CompressedStyle},
+		Interval: 10 * time.Millisecond,
+		Debounce: 50 * time.Millisecond,
+	})
+	c.Assert(err, qt.IsNil)
+
+	next := func() Event {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			c.Fatal("timed out waiting for event")
+		}
+		return Event{}
+	}
+	assertNoEvent := func() {
+		select {
+		case e := <-events:
+			c.Fatalf("unexpected event for %s", e.Entry.Filename)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+
+	// Initial build, the colors partial does not exist yet.
+	e := next()
+	c.Assert(e.Entry.Filename, qt.Equals, main)
+	c.Assert(e.Err, qt.ErrorMatches, `(?s).*File to import not found or unreadable: colors.*`)
+	e = next()
+	c.Assert(e.Entry.Filename, qt.Equals, other)
+	c.Assert(e.Err, qt.IsNil)
+	c.Assert(e.Result.CSS, qt.Equals, "b{color:red}\n")
+
+	// Creating the missing partial fixes main.
+	colors := writeFile("_colors.scss", `$primary: #ccc;`)
+	e = next()
+	c.Assert(e.Entry.Filename, qt.Equals, main)
+	c.Assert(e.Err, qt.IsNil)
+	c.Assert(e.Result.CSS, qt.Equals, "a{color:#ccc}\n")
+	b, err := os.ReadFile(target)
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(b), qt.Equals, "a{color:#ccc}\n")
+	assertNoEvent()
+
+	// A burst of changes to the partial only recompiles main, once.
+	writeFile("_colors.scss", `$primary: #ddd;`)
+	time.Sleep(10 * time.Millisecond)
+	writeFile("_colors.scss", `$primary: #eeeeee;`)
+	e = next()
+	c.Assert(e.Entry.Filename, qt.Equals, main)
+	c.Assert(e.Result.CSS, qt.Equals, "a{color:#eee}\n")
+	assertNoEvent()
+
+	// Removing it breaks main again.
+	c.Assert(os.Remove(colors), qt.IsNil)
+	e = next()
+	c.Assert(e.Entry.Filename, qt.Equals, main)
+	c.Assert(e.Err, qt.Not(qt.IsNil))
+	assertNoEvent()
+
+	// A missing partial in a subdirectory that does not exist yet.
+	writeFile("main.scss", `@import "partials/colors"; a { color: $primary; }`)
+	e = next()
+	c.Assert(e.Entry.Filename, qt.Equals, main)
+	c.Assert(e.Err, qt.ErrorMatches, `(?s).*File to import not found or unreadable: partials/colors.*`)
+	assertNoEvent()
+	c.Assert(os.Mkdir(filepath.Join(dir, "partials"), 0o755), qt.IsNil)
+	writeFile(filepath.Join("partials", "_colors.scss"), `$primary: #fff;`)
+	e = next()
+	c.Assert(e.Entry.Filename, qt.Equals, main)
+	c.Assert(e.Err, qt.IsNil)
+	c.Assert(e.Result.CSS, qt.Equals, "a{color:#fff}\n")
+	assertNoEvent()
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestWatchChangeWhileCompiling(t *testing.T) {
+	c := qt.New(t)
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		filename := filepath.Join(dir, name)
+		c.Assert(os.WriteFile(filename, []byte(content), 0o644), qt.IsNil)
+		return filename
+	}
+
+	main := writeFile("main.scss", `@import "colors"; a { color: $primary; width: slow(); }`)
+	writeFile("_colors.scss", `$primary: #ccc;`)
+
+	// The second compilation blocks in slow() until released, after
+	// LibSass has read the partial.
+	var calls atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := Watch(ctx, Config{
+		Entries: []Entry{{Filename: main}},
+		Options: libsass.Options{
+			OutputStyle: libsass.CompressedStyle,
+			Functions: map[string]func(args []sassvalue.Value) (sassvalue.Value, error){
+				"slow()": func(args []sassvalue.Value) (sassvalue.Value, error) {
+					if calls.Add(1) == 2 {
+						close(started)
+						<-release
+					}
+					return sassvalue.Number{Value: 1, Unit: "px"}, nil
+				},
+			},
+		},
+		Interval: 10 * time.Millisecond,
+		Debounce: 50 * time.Millisecond,
+	})
+	c.Assert(err, qt.IsNil)
+
+	next := func() Event {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			c.Fatal("timed out waiting for event")
+		}
+		return Event{}
+	}
+
+	c.Assert(next().Result.CSS, qt.Equals, "a{color:#ccc;width:1px}\n")
+
+	writeFile("_colors.scss", `$primary: #ddd;`)
+	<-started
+	writeFile("_colors.scss", `$primary: #eeeeee;`)
+	close(release)
+	c.Assert(next().Result.CSS, qt.Equals, "a{color:#ddd;width:1px}\n")
+
+	// The change made while compiling is not lost.
+	c.Assert(next().Result.CSS, qt.Equals, "a{color:#eee;width:1px}\n")
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestWatchFind(t *testing.T) {
+	c := qt.New(t)
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		filename := filepath.Join(dir, name)
+		c.Assert(os.MkdirAll(filepath.Dir(filename), 0o755), qt.IsNil)
+		c.Assert(os.WriteFile(filename, []byte(content), 0o644), qt.IsNil)
+		return filename
+	}
+
+	writeFile("_colors.scss", `$primary: #ccc;`)
+	a := writeFile("a.scss", `@import "colors"; a { color: $primary; }`)
+
+	compressed := libsass.Options{OutputStyle: libsass.CompressedStyle}
+	find := func() ([]Entry, error) {
+		var entries []Entry
+		for _, pattern := range []string{"*.scss", "*/*.scss"} {
+			matches, err := filepath.Glob(filepath.Join(dir, pattern))
+			if err != nil {
+				return nil, err
+			}
+			for _, filename := range matches {
+				if filepath.Base(filename)[0] != '_' {
+					entries = append(entries, Entry{Filename: filename, Options: &compressed})
+				}
+			}
+		}
+		return entries, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := Watch(ctx, Config{
+		Options:  libsass.Options{OutputStyle: libsass.ExpandedStyle},
+		Dirs:     []string{dir},
+		Find:     find,
+		Interval: 10 * time.Millisecond,
+		Debounce: 50 * time.Millisecond,
+	})
+	c.Assert(err, qt.IsNil)
+
+	next := func() Event {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			c.Fatal("timed out waiting for event")
+		}
+		return Event{}
+	}
+	assertNoEvent := func() {
+		select {
+		case e := <-events:
+			c.Fatalf("unexpected event for %s", e.Entry.Filename)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+
+	// The entry's options are used.
+	e := next()
+	c.Assert(e.Entry.Filename, qt.Equals, a)
+	c.Assert(e.Result.CSS, qt.Equals, "a{color:#ccc}\n")
+
+	// A new entry in a new subdirectory.
+	b := writeFile("sub/b.scss", `b { color: red; }`)
+	e = next()
+	c.Assert(e.Entry.Filename, qt.Equals, b)
+	c.Assert(e.Result.CSS, qt.Equals, "b{color:red}\n")
+	assertNoEvent()
+
+	// A removed entry is dropped.
+	c.Assert(os.Remove(b), qt.IsNil)
+	assertNoEvent()
+	writeFile("_colors.scss", `$primary: #ddd;`)
+	e = next()
+	c.Assert(e.Entry.Filename, qt.Equals, a)
+	c.Assert(e.Result.CSS, qt.Equals, "a{color:#ddd}\n")
+	assertNoEvent()
+
+	cancel()
+	for range events {
+	}
+}